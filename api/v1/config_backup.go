@@ -0,0 +1,195 @@
+package v1
+
+import (
+	"errors"
+	"hy2agent/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 获取配置备份列表和保留策略
+func (h *Hysteria2Handler) GetConfigBackups(c *gin.Context) {
+	backups, err := h.hy2Service.GetConfigBackups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	retention, err := h.hy2Service.GetConfigBackupRetention()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"backups": backups, "retention": retention})
+}
+
+// 下载备份内容
+func (h *Hysteria2Handler) GetConfigBackup(c *gin.Context) {
+	backup, data, err := h.hy2Service.GetConfigBackup(c.Param("name"))
+	if err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	c.Header("ETag", strconv.Quote(backup.SHA256))
+	c.Header("Content-Disposition", "attachment; filename="+strconv.Quote(backup.Filename))
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+}
+
+// 修改备份的标签、备注和固定状态
+func (h *Hysteria2Handler) UpdateConfigBackup(c *gin.Context) {
+	var req service.ConfigBackupUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	backup, err := h.hy2Service.UpdateConfigBackup(ctx, c.Param("name"), &req)
+	if err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Backup updated successfully",
+		"backup":  backup,
+	})
+}
+
+// 删除备份
+func (h *Hysteria2Handler) DeleteConfigBackup(c *gin.Context) {
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.hy2Service.DeleteConfigBackup(ctx, c.Param("name")); err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Backup deleted successfully"})
+}
+
+// 对比两个备份，或备份与当前配置
+func (h *Hysteria2Handler) DiffConfigBackups(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	if from == "" && to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from or to is required"})
+		return
+	}
+	if from == "" {
+		from = service.LiveConfigName
+	}
+	if to == "" {
+		to = service.LiveConfigName
+	}
+
+	diff, err := h.hy2Service.DiffConfigBackups(from, to)
+	if err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":      from,
+		"to":        to,
+		"identical": diff == "",
+		"diff":      diff,
+	})
+}
+
+// 获取备份保留策略
+func (h *Hysteria2Handler) GetConfigBackupRetention(c *gin.Context) {
+	retention, err := h.hy2Service.GetConfigBackupRetention()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, retention)
+}
+
+// 修改备份保留策略，超出策略的备份立即被删除
+func (h *Hysteria2Handler) UpdateConfigBackupRetention(c *gin.Context) {
+	var req service.ConfigBackupRetention
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	removed, err := h.hy2Service.SetConfigBackupRetention(ctx, &req)
+	if err != nil {
+		writeBackupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Retention policy updated successfully",
+		"retention": req,
+		"removed":   removed,
+	})
+}
+
+// 恢复配置备份
+func (h *Hysteria2Handler) RestoreConfig(c *gin.Context) {
+	var req struct {
+		Backup string `json:"backup" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验 If-Match 和恢复在同一个操作中完成
+	lease, ctx, ok := beginOperation(c, "restore_config")
+	if !ok {
+		return
+	}
+	defer lease.Release()
+
+	if !h.checkIfMatch(c) {
+		return
+	}
+
+	result, err := h.hy2Service.RestoreConfig(ctx, req.Backup)
+	if err != nil {
+		var applyErr *service.ConfigApplyError
+		if errors.As(err, &applyErr) {
+			writeApplyError(c, err)
+		} else {
+			writeBackupError(c, err)
+		}
+		return
+	}
+	h.setConfigETag(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Config restored successfully",
+		"restored_from":     req.Backup,
+		"service_restarted": true,
+		"backup_file":       result.BackupFile,
+		"rolled_back":       result.RolledBack,
+	})
+}
+
+// 文件名或保留策略无效返回 400，备份不存在返回 404，删除固定的备份返回 409
+func writeBackupError(c *gin.Context, err error) {
+	if writeOperationBusy(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidBackup), errors.Is(err, service.ErrInvalidRetention):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrBackupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrBackupPinned):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,20 +1,32 @@
 package v1
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hy2agent/internal/config"
 	"hy2agent/internal/service"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Hysteria2Handler struct {
-	hy2Service *service.Hysteria2Service
+	hy2Service  *service.Hysteria2Service
+	installer   *service.Installer
+	jobs        *service.JobManager
+	certService *service.CertificateService
 }
 
-func NewHysteria2Handler() *Hysteria2Handler {
+func NewHysteria2Handler(cfg *config.Config, jobs *service.JobManager, certService *service.CertificateService) *Hysteria2Handler {
 	return &Hysteria2Handler{
-		hy2Service: service.NewHysteria2Service(),
+		hy2Service:  service.NewHysteria2Service(),
+		installer:   service.NewInstaller(service.NewHTTPReleaseSource(cfg.ReleaseBaseURL)),
+		jobs:        jobs,
+		certService: certService,
 	}
 }
 
@@ -25,55 +37,112 @@ func (h *Hysteria2Handler) GetStatus(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	status.Certificates = h.certService.Inspect()
 	c.JSON(http.StatusOK, status)
 }
 
-// 安装Hysteria2
+// 获取 hysteria 和 agent 使用的证书
+func (h *Hysteria2Handler) GetCertificates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"warn_days":    h.certService.WarnDays(),
+		"certificates": h.certService.Inspect(),
+	})
+}
+
+// 获取 hysteria 进程的资源占用，开销较小，适合频繁轮询
+func (h *Hysteria2Handler) GetProcess(c *gin.Context) {
+	metrics, err := h.hy2Service.GetProcessMetrics()
+	if err != nil {
+		if errors.Is(err, service.ErrServiceNotRunning) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, metrics)
+}
+
+// 安装Hysteria2，在后台任务中执行
 func (h *Hysteria2Handler) Install(c *gin.Context) {
-	output, err := h.hy2Service.Install()
+	// 在请求中获取操作锁，锁被占用时直接返回 409，任务结束时释放
+	lease, _, ok := beginOperation(c, "install")
+	if !ok {
+		return
+	}
+	job := h.jobs.Start("install", func(ctx context.Context, out io.Writer) (interface{}, error) {
+		defer lease.Release()
+		ctx = service.WithOperation(ctx, lease)
+		return installJobResult(h.installer.WithContext(ctx, out).Install())
+	})
+	lease.SetJob(job.ID)
+	writeJobAccepted(c, "Hysteria2 installation started", job)
+}
+
+// 上传二进制文件或压缩包离线安装
+func (h *Hysteria2Handler) InstallUpload(c *gin.Context) {
+	header, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  err.Error(),
-			"output": output,
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.installer.WithContext(ctx, io.Discard).InstallUpload(file, header.Filename, c.PostForm("sha256"))
+	if err != nil {
+		writeInstallError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Hysteria2 installed successfully",
-		"output":  output,
+		"message":     "Hysteria2 installed successfully",
+		"old_version": result.PreviousVersion,
+		"version":     result.Version,
+		"asset":       result.Asset,
+		"sha256":      result.SHA256,
+		"restarted":   result.Restarted,
 	})
 }
 
-// 卸载Hysteria2
+// 卸载Hysteria2，在后台任务中执行
 func (h *Hysteria2Handler) Uninstall(c *gin.Context) {
-	output, err := h.hy2Service.Uninstall()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  err.Error(),
-			"output": output,
-		})
+	// 在请求中获取操作锁，锁被占用时直接返回 409，任务结束时释放
+	lease, _, ok := beginOperation(c, "uninstall")
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Hysteria2 uninstalled successfully",
-		"output":  output,
+	job := h.jobs.Start("uninstall", func(ctx context.Context, out io.Writer) (interface{}, error) {
+		defer lease.Release()
+		ctx = service.WithOperation(ctx, lease)
+		return nil, h.hy2Service.Uninstall(ctx, out)
 	})
+	lease.SetJob(job.ID)
+	writeJobAccepted(c, "Hysteria2 uninstallation started", job)
 }
 
-// 更新Hysteria2
+// 更新Hysteria2，在后台任务中执行
 func (h *Hysteria2Handler) Update(c *gin.Context) {
-	output, err := h.hy2Service.Update()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  err.Error(),
-			"output": output,
-		})
+	// 在请求中获取操作锁，锁被占用时直接返回 409，任务结束时释放
+	lease, _, ok := beginOperation(c, "update")
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Hysteria2 updated successfully",
-		"output":  output,
+	job := h.jobs.Start("update", func(ctx context.Context, out io.Writer) (interface{}, error) {
+		defer lease.Release()
+		ctx = service.WithOperation(ctx, lease)
+		return installJobResult(h.installer.WithContext(ctx, out).Update())
 	})
+	lease.SetJob(job.ID)
+	writeJobAccepted(c, "Hysteria2 update started", job)
 }
 
 // 获取配置
@@ -83,24 +152,310 @@ func (h *Hysteria2Handler) GetConfig(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"config": config})
+	hash := service.ConfigHash([]byte(config))
+	c.Header("ETag", strconv.Quote(hash))
+	c.JSON(http.StatusOK, gin.H{"config": config, "hash": hash})
 }
 
 // 更新配置
 func (h *Hysteria2Handler) UpdateConfig(c *gin.Context) {
 	var req struct {
 		Config string `json:"config" binding:"required"`
+		Force  bool   `json:"force"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 先校验配置，除非强制写入
+	validation := h.hy2Service.ValidateConfig(req.Config)
+	if !validation.Valid && !req.Force {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    service.ErrConfigInvalid.Error(),
+			"errors":   validation.Errors,
+			"warnings": validation.Warnings,
+		})
+		return
+	}
+
+	// 校验 If-Match 和写入在同一个操作中完成
+	lease, ctx, ok := beginOperation(c, "update_config")
+	if !ok {
+		return
+	}
+	defer lease.Release()
+
+	if !h.checkIfMatch(c) {
+		return
+	}
+
+	result, err := h.hy2Service.UpdateConfig(ctx, req.Config)
+	if err != nil {
+		writeApplyError(c, err)
+		return
+	}
+	h.setConfigETag(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Config updated successfully",
+		"backup_file": result.BackupFile,
+		"rolled_back": result.RolledBack,
+	})
+}
+
+// 按补丁修改配置，保留原文件中的注释和格式
+// Content-Type 为 application/merge-patch+json 时按 RFC 7396 处理，application/json-patch+json 时按 RFC 6902 处理
+// 其他类型按请求体判断，数组为 JSON Patch，对象为 Merge Patch
+func (h *Hysteria2Handler) PatchConfig(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil || len(strings.TrimSpace(string(body))) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body is required"})
+		return
+	}
+
+	var format string
+	switch c.ContentType() {
+	case "application/merge-patch+json":
+		format = service.ConfigPatchMerge
+	case "application/json-patch+json":
+		format = service.ConfigPatchJSON
+	default:
+		switch strings.TrimSpace(string(body))[0] {
+		case '[':
+			format = service.ConfigPatchJSON
+		case '{':
+			format = service.ConfigPatchMerge
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "patch must be a JSON object or array"})
+			return
+		}
+	}
+
+	// 校验 If-Match、计算补丁和写入在同一个操作中完成
+	lease, ctx, ok := beginOperation(c, "patch_config")
+	if !ok {
+		return
+	}
+	defer lease.Release()
+
+	if !h.checkIfMatch(c) {
+		return
+	}
+
+	data, err := h.hy2Service.PatchedConfig(format, body)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidConfigPatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验修改后的配置，除非强制写入
+	validation := h.hy2Service.ValidateConfig(string(data))
+	if !validation.Valid && c.Query("force") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    service.ErrConfigInvalid.Error(),
+			"errors":   validation.Errors,
+			"warnings": validation.Warnings,
+		})
+		return
+	}
+
+	result, err := h.hy2Service.UpdateConfig(ctx, string(data))
+	if err != nil {
+		writeApplyError(c, err)
+		return
+	}
+	h.setConfigETag(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Config patched successfully",
+		"config":      string(data),
+		"backup_file": result.BackupFile,
+		"rolled_back": result.RolledBack,
+	})
+}
+
+// 校验候选配置
+func (h *Hysteria2Handler) ValidateConfig(c *gin.Context) {
+	var req struct {
+		Config string `json:"config" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, h.hy2Service.ValidateConfig(req.Config))
+}
+
+// 预览配置变更，不写入任何内容
+// 请求中提供 config 时预览完整配置替换，提供 section 和 patch 时预览配置段修改
+func (h *Hysteria2Handler) PreviewConfig(c *gin.Context) {
+	var req struct {
+		Config  string          `json:"config"`
+		Section string          `json:"section"`
+		Patch   json.RawMessage `json:"patch"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.hy2Service.UpdateConfig(req.Config); err != nil {
+	var preview *service.ConfigPreview
+	var err error
+	switch {
+	case req.Config != "" && req.Section == "":
+		preview, err = h.hy2Service.PreviewConfig([]byte(req.Config))
+	case req.Config == "" && req.Section != "" && len(req.Patch) > 0:
+		preview, err = h.hy2Service.PreviewConfigSection(req.Section, req.Patch)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either config or section and patch is required"})
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownSection):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidSectionPatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// 输出配置应用失败的结构化错误
+func writeApplyError(c *gin.Context, err error) {
+	if writeOperationBusy(c, err) {
+		return
+	}
+	var applyErr *service.ConfigApplyError
+	if errors.As(err, &applyErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":           applyErr.Error(),
+			"reason":          applyErr.Reason,
+			"backup_file":     applyErr.BackupFile,
+			"rolled_back":     applyErr.RolledBack,
+			"restored_backup": applyErr.RestoredBackup,
+			"rollback_error":  applyErr.RollbackError,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// 校验 If-Match 请求头，配置文件已被修改时返回 412 和当前的哈希
+// 未提供 If-Match 时不做检查，"*" 匹配任意内容
+func (h *Hysteria2Handler) checkIfMatch(c *gin.Context) bool {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+
+	var hashes []string
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		hashes = append(hashes, strings.Trim(tag, `"`))
+	}
+
+	current, err := h.hy2Service.MatchConfigHash(hashes)
+	if err != nil {
+		if errors.Is(err, service.ErrConfigChanged) {
+			c.Header("ETag", strconv.Quote(current))
+			c.JSON(http.StatusPreconditionFailed, gin.H{
+				"error":        err.Error(),
+				"current_hash": current,
+			})
+			return false
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// 写入成功后返回新配置的 ETag
+func (h *Hysteria2Handler) setConfigETag(c *gin.Context) {
+	if hash, err := h.hy2Service.GetConfigHash(); err == nil {
+		c.Header("ETag", strconv.Quote(hash))
+	}
+}
+
+// 获取单个配置段
+func (h *Hysteria2Handler) GetConfigSection(c *gin.Context) {
+	section := c.Param("section")
+	value, err := h.hy2Service.GetConfigSection(section)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownSection) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"section": section, "config": value})
+}
+
+// 修改单个配置段
+func (h *Hysteria2Handler) PatchConfigSection(c *gin.Context) {
+	section := c.Param("section")
+	body, err := c.GetRawData()
+	if err != nil || len(body) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body is required"})
+		return
+	}
+
+	// 校验 If-Match、合并和写入在同一个操作中完成
+	lease, ctx, ok := beginOperation(c, "patch_config_section")
+	if !ok {
+		return
+	}
+	defer lease.Release()
+
+	if !h.checkIfMatch(c) {
+		return
+	}
+
+	value, data, err := h.hy2Service.PatchedConfigSection(section, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownSection):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidSectionPatch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// 校验合并后的完整配置，除非强制写入
+	validation := h.hy2Service.ValidateConfig(string(data))
+	if !validation.Valid && c.Query("force") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    service.ErrConfigInvalid.Error(),
+			"errors":   validation.Errors,
+			"warnings": validation.Warnings,
+		})
+		return
+	}
+
+	result, err := h.hy2Service.UpdateConfig(ctx, string(data))
+	if err != nil {
+		writeApplyError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Config updated successfully"})
+	h.setConfigETag(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Config section updated successfully",
+		"section":     section,
+		"config":      value,
+		"backup_file": result.BackupFile,
+		"rolled_back": result.RolledBack,
+	})
 }
 
 // 获取日志
@@ -125,7 +480,15 @@ func (h *Hysteria2Handler) GetLogs(c *gin.Context) {
 
 // 启动服务
 func (h *Hysteria2Handler) Start(c *gin.Context) {
-	if err := h.hy2Service.Start(); err != nil {
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.hy2Service.Start(ctx); err != nil {
+		if writeOperationBusy(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -134,7 +497,15 @@ func (h *Hysteria2Handler) Start(c *gin.Context) {
 
 // 停止服务
 func (h *Hysteria2Handler) Stop(c *gin.Context) {
-	if err := h.hy2Service.Stop(); err != nil {
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.hy2Service.Stop(ctx); err != nil {
+		if writeOperationBusy(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -143,7 +514,15 @@ func (h *Hysteria2Handler) Stop(c *gin.Context) {
 
 // 重启服务
 func (h *Hysteria2Handler) Restart(c *gin.Context) {
-	if err := h.hy2Service.Restart(); err != nil {
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	if err := h.hy2Service.Restart(ctx); err != nil {
+		if writeOperationBusy(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -157,6 +536,7 @@ func (h *Hysteria2Handler) CheckHealth(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	health.AddCertificates(h.certService.Inspect())
 	c.JSON(http.StatusOK, health)
 }
 
@@ -180,36 +560,119 @@ func (h *Hysteria2Handler) InstallVersion(c *gin.Context) {
 		return
 	}
 
-	if err := h.hy2Service.InstallVersion(req.Version); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 先校验版本号，格式错误时直接返回 400
+	version, err := service.NormalizeVersion(req.Version)
+	if err != nil {
+		writeInstallError(c, err)
+		return
+	}
+
+	// 在请求中获取操作锁，锁被占用时直接返回 409，任务结束时释放
+	lease, _, ok := beginOperation(c, "install_version")
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Version installed successfully"})
+	job := h.jobs.Start("install_version", func(ctx context.Context, out io.Writer) (interface{}, error) {
+		defer lease.Release()
+		ctx = service.WithOperation(ctx, lease)
+		return installJobResult(h.installer.WithContext(ctx, out).InstallVersion(version))
+	})
+	lease.SetJob(job.ID)
+	writeJobAccepted(c, "Version installation started", job)
+}
+
+// 安装任务的结果，新版本启动失败时返回回滚详情
+func installJobResult(result *service.InstallResult, err error) (interface{}, error) {
+	var installErr *service.InstallError
+	if errors.As(err, &installErr) {
+		return installErr, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-// 获取配置备份列表
-func (h *Hysteria2Handler) GetConfigBackups(c *gin.Context) {
-	backups, err := h.hy2Service.GetConfigBackups()
+// 获取保存的 hysteria 二进制文件
+func (h *Hysteria2Handler) GetBinaries(c *gin.Context) {
+	binaries, err := h.installer.ListBinaries()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"backups": backups})
+	c.JSON(http.StatusOK, gin.H{
+		"current":  h.hy2Service.GetVersion(),
+		"binaries": binaries,
+	})
 }
 
-// 恢复配置备份
-func (h *Hysteria2Handler) RestoreConfig(c *gin.Context) {
+// 回滚到保存的二进制文件，未指定版本时回滚到上一个版本
+func (h *Hysteria2Handler) Rollback(c *gin.Context) {
 	var req struct {
-		Backup string `json:"backup" binding:"required"`
+		Version string `json:"version"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.installer.WithContext(ctx, io.Discard).Rollback(req.Version)
+	if err != nil {
+		writeInstallError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Rolled back successfully",
+		"old_version": result.PreviousVersion,
+		"new_version": result.Version,
+		"sha256":      result.SHA256,
+		"restarted":   result.Restarted,
+	})
+}
+
+// 解析可以为空的 JSON 请求体，失败时已写入响应
+// 不依赖 Content-Length，分块传输的请求同样可以解析
+func bindOptionalJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// 版本号或上传文件无效返回 400，版本不存在返回 404，平台不受支持或没有可回滚的版本返回 409，校验失败返回 502
+// 新版本启动失败时返回回滚结果
+func writeInstallError(c *gin.Context, err error) {
+	if writeOperationBusy(c, err) {
+		return
+	}
+	var installErr *service.InstallError
+	if errors.As(err, &installErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":            installErr.Error(),
+			"version":          installErr.Version,
+			"reason":           installErr.Reason,
+			"rolled_back":      installErr.RolledBack,
+			"restored_version": installErr.RestoredVersion,
+			"rollback_error":   installErr.RollbackError,
+		})
 		return
 	}
 
-	if err := h.hy2Service.RestoreConfig(req.Backup); err != nil {
+	switch {
+	case errors.Is(err, service.ErrInvalidVersion), errors.Is(err, service.ErrInvalidUpload):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrBinaryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUnsupportedPlatform), errors.Is(err, service.ErrNoRollbackTarget):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrChecksumMismatch):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Config restored successfully"})
 }
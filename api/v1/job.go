@@ -0,0 +1,96 @@
+package v1
+
+import (
+	"errors"
+	"hy2agent/internal/service"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	jobs *service.JobManager
+}
+
+func NewJobHandler(jobs *service.JobManager) *JobHandler {
+	return &JobHandler{
+		jobs: jobs,
+	}
+}
+
+// 获取任务列表
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"jobs": h.jobs.List()})
+}
+
+// 获取任务状态，offset 为已读取的输出字节数，只返回之后的输出
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, err := h.jobs.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	snapshot, _ := job.Snapshot(offset)
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// 通过 SSE 实时推送任务输出，任务结束时推送 done 事件并关闭连接
+func (h *JobHandler) StreamJob(c *gin.Context) {
+	job, err := h.jobs.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		snapshot, changed := job.Snapshot(offset)
+		if snapshot.Output != "" {
+			c.SSEvent("output", snapshot.Output)
+			offset = snapshot.OutputSize
+		}
+		if snapshot.EndedAt != nil {
+			snapshot.Output = ""
+			c.SSEvent("done", snapshot)
+			return false
+		}
+
+		select {
+		case <-changed:
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// 取消任务
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	if err := h.jobs.Cancel(c.Param("id")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Job cancellation requested"})
+}
+
+// 返回 202 和任务信息
+func writeJobAccepted(c *gin.Context, message string, job *service.Job) {
+	snapshot, _ := job.Snapshot(0)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": message,
+		"job_id":  job.ID,
+		"job":     snapshot,
+	})
+}
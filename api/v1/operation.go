@@ -0,0 +1,74 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hy2agent/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 获取当前正在执行的修改操作
+func (h *Hysteria2Handler) GetCurrentOperation(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"operation": h.hy2Service.CurrentOperation()})
+}
+
+// 修改操作使用的上下文，操作锁由服务在修改时获取，失败时已写入响应
+// 查询参数 wait 指定锁被占用时的最长等待时间，如 "30s" 或 "30"（秒），默认不等待直接返回 409
+// 上下文不随请求取消，避免客户端断开时配置只应用了一半
+func operationContext(c *gin.Context) (context.Context, bool) {
+	wait, err := parseOperationWait(c.Query("wait"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return service.WithOperationWait(context.Background(), wait), true
+}
+
+// 提前获取操作锁，用于需要在同一个操作中完成多个步骤，或在后台任务中执行的请求
+// 使用返回的上下文调用修改方法时不再重复获取，失败时已写入响应
+func beginOperation(c *gin.Context, name string) (*service.OperationLease, context.Context, bool) {
+	ctx, ok := operationContext(c)
+	if !ok {
+		return nil, nil, false
+	}
+	lease, ctx, err := service.BeginOperation(ctx, name)
+	if err != nil {
+		if !writeOperationBusy(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, nil, false
+	}
+	return lease, ctx, true
+}
+
+// 操作锁被占用时返回 409 和正在执行的操作，返回是否已写入响应
+func writeOperationBusy(c *gin.Context, err error) bool {
+	var busyErr *service.OperationBusyError
+	if !errors.As(err, &busyErr) {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":     busyErr.Error(),
+		"operation": busyErr.Current,
+	})
+	return true
+}
+
+func parseOperationWait(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		value = fmt.Sprintf("%ds", seconds)
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("invalid wait %q", value)
+	}
+	return wait, nil
+}
@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"errors"
+	"hy2agent/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PortHoppingHandler struct {
+	portHoppingService *service.PortHoppingService
+}
+
+func NewPortHoppingHandler() *PortHoppingHandler {
+	return &PortHoppingHandler{
+		portHoppingService: service.NewPortHoppingService(),
+	}
+}
+
+// 获取端口跳跃设置和当前的转发规则
+func (h *PortHoppingHandler) GetPortHopping(c *gin.Context) {
+	status, err := h.portHoppingService.GetStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// 修改端口跳跃设置，enabled 为 false 时删除转发规则
+func (h *PortHoppingHandler) UpdatePortHopping(c *gin.Context) {
+	var req struct {
+		Enabled   *bool  `json:"enabled" binding:"required"`
+		StartPort int    `json:"start_port"`
+		EndPort   int    `json:"end_port"`
+		Interface string `json:"interface"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.portHoppingService.SetConfig(ctx, &service.PortHoppingConfig{
+		Enabled:   *req.Enabled,
+		StartPort: req.StartPort,
+		EndPort:   req.EndPort,
+		Interface: req.Interface,
+	})
+	if err != nil {
+		switch {
+		case writeOperationBusy(c, err):
+		case errors.Is(err, service.ErrInvalidPortHopping):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNoFirewallBackend):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
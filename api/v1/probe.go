@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"fmt"
+	"hy2agent/internal/config"
+	"hy2agent/internal/service"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 探测允许的最长超时时间(秒)
+const maxProbeTimeout = 60
+
+type ProbeHandler struct {
+	probeService *service.ProbeService
+}
+
+func NewProbeHandler(cfg *config.Config, authServer *service.AuthServer, trafficService *service.TrafficService) *ProbeHandler {
+	return &ProbeHandler{
+		probeService: service.NewProbeService(service.NewUserService(authServer, trafficService), cfg.ProbeUser),
+	}
+}
+
+// 用 Hysteria2 客户端连接本机服务端，握手失败不视为请求错误，结果中的 stage 指出失败的阶段
+func (h *ProbeHandler) Probe(c *gin.Context) {
+	var req struct {
+		User    string `json:"user"`
+		Auth    string `json:"auth"`
+		Target  string `json:"target"`
+		Timeout *int   `json:"timeout"` // 秒，省略时使用默认值
+	}
+	// 请求体可以为空
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	opts := service.ProbeOptions{
+		User:   req.User,
+		Auth:   req.Auth,
+		Target: req.Target,
+	}
+	if req.Timeout != nil {
+		if *req.Timeout < 1 || *req.Timeout > maxProbeTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeout must be between 1 and %d seconds", maxProbeTimeout)})
+			return
+		}
+		opts.Timeout = time.Duration(*req.Timeout) * time.Second
+	}
+
+	result := h.probeService.Probe(opts)
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"errors"
+	"hy2agent/internal/service"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StagedConfigHandler struct {
+	stagedService *service.StagedConfigService
+	hy2Service    *service.Hysteria2Service
+}
+
+func NewStagedConfigHandler(stagedService *service.StagedConfigService) *StagedConfigHandler {
+	return &StagedConfigHandler{
+		stagedService: stagedService,
+		hy2Service:    service.NewHysteria2Service(),
+	}
+}
+
+// 获取计划变更列表
+func (h *StagedConfigHandler) ListStagedConfigs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"staged": h.stagedService.List()})
+}
+
+// 获取计划变更详情
+func (h *StagedConfigHandler) GetStagedConfig(c *gin.Context) {
+	stage, err := h.stagedService.Get(c.Param("id"))
+	if err != nil {
+		writeStageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stage)
+}
+
+// 提交计划变更，到期后自动应用
+func (h *StagedConfigHandler) CreateStagedConfig(c *gin.Context) {
+	var req struct {
+		Config   string    `json:"config" binding:"required"`
+		ApplyAt  time.Time `json:"apply_at" binding:"required"`
+		Note     string    `json:"note"`
+		BaseHash string    `json:"base_hash"`
+		Force    bool      `json:"force"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 提交时先校验配置，除非强制提交
+	validation := h.hy2Service.ValidateConfig(req.Config)
+	if !validation.Valid && !req.Force {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    service.ErrConfigInvalid.Error(),
+			"errors":   validation.Errors,
+			"warnings": validation.Warnings,
+		})
+		return
+	}
+
+	stage, err := h.stagedService.Stage(req.Config, req.ApplyAt, req.Note, req.BaseHash)
+	if err != nil {
+		writeStageError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Config staged successfully",
+		"staged":  stage,
+	})
+}
+
+// 取消尚未应用的计划变更
+func (h *StagedConfigHandler) CancelStagedConfig(c *gin.Context) {
+	stage, err := h.stagedService.Cancel(c.Param("id"))
+	if err != nil {
+		writeStageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Staged config cancelled",
+		"staged":  stage,
+	})
+}
+
+// 参数无效返回 400，不存在返回 404，已应用或已取消返回 409
+func writeStageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidStage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStageNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,63 @@
+package v1
+
+import (
+	"errors"
+	"hy2agent/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubscriptionHandler struct {
+	subService *service.SubscriptionService
+}
+
+func NewSubscriptionHandler(apiKey string, authServer *service.AuthServer, trafficService *service.TrafficService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subService: service.NewSubscriptionService(apiKey, service.NewUserService(authServer, trafficService)),
+	}
+}
+
+// 获取订阅内容，格式由 format 参数或 User-Agent 决定
+func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
+	user, err := h.subService.FindUser(c.Param("token"))
+	if err != nil {
+		// 不区分令牌错误和其他错误，避免泄露信息
+		c.String(http.StatusNotFound, "not found")
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = service.DetectSubFormat(c.GetHeader("User-Agent"))
+	}
+
+	sub, err := h.subService.Render(user, format)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownSubFormat) {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if sub.UserInfo != "" {
+		c.Header("subscription-userinfo", sub.UserInfo)
+	}
+	c.Header("profile-update-interval", "24")
+	c.Data(http.StatusOK, sub.ContentType, sub.Content)
+}
+
+// 获取用户的订阅令牌
+func (h *SubscriptionHandler) GetToken(c *gin.Context) {
+	token, err := h.subService.GetToken(c.Param("name"))
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token": token,
+		"path":  "/sub/" + token,
+	})
+}
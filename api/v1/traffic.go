@@ -0,0 +1,113 @@
+package v1
+
+import (
+	"errors"
+	"hy2agent/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrafficHandler struct {
+	trafficService *service.TrafficService
+}
+
+func NewTrafficHandler(trafficService *service.TrafficService) *TrafficHandler {
+	return &TrafficHandler{
+		trafficService: trafficService,
+	}
+}
+
+// 获取每个用户的累计流量
+func (h *TrafficHandler) GetTraffic(c *gin.Context) {
+	clear, _ := strconv.ParseBool(c.Query("clear"))
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+	traffic, err := h.trafficService.GetTraffic(ctx, clear)
+	if err != nil {
+		writeTrafficError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"traffic": traffic})
+}
+
+// 获取在线用户
+func (h *TrafficHandler) GetOnline(c *gin.Context) {
+	online, err := h.trafficService.GetOnline()
+	if err != nil {
+		writeTrafficError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"online": online})
+}
+
+// 踢出用户
+func (h *TrafficHandler) Kick(c *gin.Context) {
+	var req struct {
+		Users []string `json:"users" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+	if err := h.trafficService.Kick(ctx, req.Users); err != nil {
+		writeTrafficError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Users kicked successfully"})
+}
+
+// 获取 trafficStats 状态
+func (h *TrafficHandler) GetTrafficStats(c *gin.Context) {
+	status, err := h.trafficService.GetStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// 启用或停用 trafficStats
+func (h *TrafficHandler) UpdateTrafficStats(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.trafficService.SetEnabled(ctx, *req.Enabled)
+	if err != nil {
+		writeApplyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withApplyResult(gin.H{
+		"message": "trafficStats updated successfully",
+	}, result))
+}
+
+// trafficStats 未启用或操作锁被占用时返回 409
+func writeTrafficError(c *gin.Context, err error) {
+	if writeOperationBusy(c, err) {
+		return
+	}
+	if errors.Is(err, service.ErrTrafficStatsDisabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
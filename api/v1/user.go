@@ -0,0 +1,268 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"hy2agent/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserHandler struct {
+	userService  *service.UserService
+	shareService *service.ShareService
+}
+
+func NewUserHandler(authServer *service.AuthServer, trafficService *service.TrafficService) *UserHandler {
+	userService := service.NewUserService(authServer, trafficService)
+	return &UserHandler{
+		userService:  userService,
+		shareService: service.NewShareService(userService),
+	}
+}
+
+// 获取用户列表
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	users, err := h.userService.ListUsers()
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// 获取单个用户
+func (h *UserHandler) GetUser(c *gin.Context) {
+	user, err := h.userService.GetUser(c.Param("name"))
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// 新增用户
+func (h *UserHandler) AddUser(c *gin.Context) {
+	var req service.UserInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	users, result, err := h.userService.AddUsers(ctx, []service.UserInput{req}, false)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withApplyResult(gin.H{
+		"message": "User added successfully",
+		"user":    users[0],
+	}, result))
+}
+
+// 批量导入用户
+func (h *UserHandler) ImportUsers(c *gin.Context) {
+	var req struct {
+		Users            []service.UserInput `json:"users" binding:"required"`
+		GeneratePassword bool                `json:"generate_password"` // 为所有未提供密码的用户生成密码
+		Overwrite        bool                `json:"overwrite"`         // 覆盖已存在用户的密码
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for i := range req.Users {
+		if req.GeneratePassword && req.Users[i].Password == "" {
+			req.Users[i].GeneratePassword = true
+		}
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	users, result, err := h.userService.AddUsers(ctx, req.Users, req.Overwrite)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withApplyResult(gin.H{
+		"message": "Users imported successfully",
+		"users":   users,
+	}, result))
+}
+
+// 修改用户
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	var req service.UserInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 修改和踢出在同一个操作中完成
+	lease, ctx, ok := beginOperation(c, "update_user")
+	if !ok {
+		return
+	}
+	defer lease.Release()
+
+	user, result, err := h.userService.UpdateUser(ctx, c.Param("name"), req)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	resp := withApplyResult(gin.H{
+		"message": "User updated successfully",
+		"user":    user,
+	}, result)
+	if !user.Enabled {
+		h.kickUser(ctx, resp, user.Username)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// 删除用户
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	// 删除和踢出在同一个操作中完成
+	lease, ctx, ok := beginOperation(c, "delete_user")
+	if !ok {
+		return
+	}
+	defer lease.Release()
+
+	name := c.Param("name")
+	result, err := h.userService.DeleteUser(ctx, name)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	resp := withApplyResult(gin.H{
+		"message": "User deleted successfully",
+	}, result)
+	h.kickUser(ctx, resp, name)
+	c.JSON(http.StatusOK, resp)
+}
+
+// 踢出已删除或禁用的用户，用户本身已修改成功，踢出失败只在响应中说明
+func (h *UserHandler) kickUser(ctx context.Context, resp gin.H, name string) {
+	kicked, err := h.userService.KickUser(ctx, name)
+	if err != nil {
+		resp["kick_error"] = err.Error()
+		return
+	}
+	resp["kicked"] = kicked
+}
+
+// 获取用户的分享链接，format=png 时返回二维码图片
+func (h *UserHandler) GetShareLink(c *gin.Context) {
+	name := c.Param("name")
+	host := c.Query("host")
+
+	if c.Query("format") == "png" {
+		size, _ := strconv.Atoi(c.Query("size"))
+		png, err := h.shareService.GetShareQRCode(name, host, size)
+		if err != nil {
+			writeUserError(c, err)
+			return
+		}
+		c.Data(http.StatusOK, "image/png", png)
+		return
+	}
+
+	link, err := h.shareService.GetShareLink(name, host)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// 解析分享链接，返回对应的服务端配置字段
+func (h *UserHandler) ParseShareLink(c *gin.Context) {
+	var req struct {
+		URI string `json:"uri" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	link, err := service.ParseShareURI(req.URI)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"link":   link,
+		"config": link.ToConfig(),
+	})
+}
+
+// 获取认证方式状态
+func (h *UserHandler) GetAuthBackend(c *gin.Context) {
+	status, err := h.userService.GetAuthBackend()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// 启用或停用内置 HTTP 认证
+func (h *UserHandler) UpdateAuthBackend(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, ok := operationContext(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.userService.SetHTTPAuth(ctx, *req.Enabled)
+	if err != nil {
+		writeUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withApplyResult(gin.H{
+		"message": "Auth backend updated successfully",
+	}, result))
+}
+
+// userpass 模式下的修改会重启服务，附带备份信息；HTTP 认证模式下立即生效，无需重启
+func withApplyResult(resp gin.H, result *service.ConfigApplyResult) gin.H {
+	resp["restarted"] = result != nil && result.BackupFile != ""
+	if result != nil && result.BackupFile != "" {
+		resp["backup_file"] = result.BackupFile
+	}
+	return resp
+}
+
+// 按错误类型返回对应状态码
+func writeUserError(c *gin.Context, err error) {
+	switch {
+	case writeOperationBusy(c, err):
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUserExists), errors.Is(err, service.ErrAuthNotManaged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidUser):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		writeApplyError(c, err)
+	}
+}
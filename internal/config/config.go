@@ -9,8 +9,13 @@ import (
 )
 
 type Config struct {
-	APIKey      string   `json:"api_key"`
-	IPWhitelist []string `json:"ip_whitelist,omitempty"`
+	APIKey         string   `json:"api_key"`
+	IPWhitelist    []string `json:"ip_whitelist,omitempty"`
+	HTTPAuthListen string   `json:"http_auth_listen,omitempty"` // 内置 HTTP 认证监听地址，仅限回环地址
+	TrafficPoll    int      `json:"traffic_poll,omitempty"`     // 流量采集间隔(秒)
+	ReleaseBaseURL string   `json:"release_base_url,omitempty"` // hysteria 发布源地址，可指向本地镜像
+	ProbeUser      string   `json:"probe_user,omitempty"`       // 端到端探测使用的用户，为空时使用第一个可用用户
+	CertWarnDays   int      `json:"cert_warn_days,omitempty"`   // 证书到期前多少天开始提醒，默认 14
 }
 
 const (
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const DefaultHTTPAuthListen = "127.0.0.1:18989"
+
+// 内置 HTTP 认证服务，供 hysteria 的 auth.type: http 调用
+type AuthServer struct {
+	store  *UserStore
+	listen string
+}
+
+// hysteria 发送的认证请求
+type authRequest struct {
+	Addr string `json:"addr"`
+	Auth string `json:"auth"`
+	Tx   uint64 `json:"tx"`
+}
+
+// 返回给 hysteria 的认证结果
+type authResponse struct {
+	OK bool   `json:"ok"`
+	ID string `json:"id"`
+}
+
+func NewAuthServer(store *UserStore, listen string) *AuthServer {
+	if listen == "" {
+		listen = DefaultHTTPAuthListen
+	}
+	return &AuthServer{
+		store:  store,
+		listen: listen,
+	}
+}
+
+// 用户存储
+func (a *AuthServer) Store() *UserStore {
+	return a.store
+}
+
+// hysteria 配置中 auth.http.url 应指向的地址
+func (a *AuthServer) URL() string {
+	return fmt.Sprintf("http://%s/auth", a.listen)
+}
+
+// 启动认证服务，仅允许监听回环地址
+func (a *AuthServer) Run() error {
+	host, _, err := net.SplitHostPort(a.listen)
+	if err != nil {
+		return fmt.Errorf("invalid auth listen address %q: %v", a.listen, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("auth listen address %q is not a loopback address", a.listen)
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.POST("/auth", a.handleAuth)
+
+	log.Printf("启动 HTTP 认证服务在 %s", a.listen)
+	return http.ListenAndServe(a.listen, r)
+}
+
+// 处理 hysteria 的认证请求，认证字符串格式为 "用户名:密码"
+// 与 hysteria 的 userpass 认证一致，用户名不区分大小写
+func (a *AuthServer) handleAuth(c *gin.Context) {
+	var req authRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, authResponse{OK: false})
+		return
+	}
+
+	name, password, ok := strings.Cut(req.Auth, ":")
+	name = normalizeUsername(name)
+	if !ok || !a.store.Authenticate(name, password) {
+		c.JSON(http.StatusOK, authResponse{OK: false})
+		return
+	}
+	c.JSON(http.StatusOK, authResponse{OK: true, ID: name})
+}
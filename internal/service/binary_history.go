@@ -0,0 +1,189 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	binaryHistoryDir   = "/var/lib/hy2agent/binaries"
+	binaryHistoryIndex = "index.json"
+	maxBinaries        = 5
+)
+
+var ErrBinaryNotFound = fmt.Errorf("binary version not found")
+
+// 保存的 hysteria 二进制文件
+type BinaryVersion struct {
+	Version     string    `json:"version"`
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	File        string    `json:"file"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// 最近安装过的 hysteria 二进制文件，最多保留 maxBinaries 个，用于回滚
+type BinaryHistory struct {
+	dir string
+}
+
+func NewBinaryHistory() *BinaryHistory {
+	return &BinaryHistory{dir: binaryHistoryDir}
+}
+
+// 按安装时间倒序列出
+func (b *BinaryHistory) List() ([]BinaryVersion, error) {
+	data, err := os.ReadFile(filepath.Join(b.dir, binaryHistoryIndex))
+	if os.IsNotExist(err) {
+		return []BinaryVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []BinaryVersion
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return nil, err
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].InstalledAt.After(versions[j].InstalledAt)
+	})
+	return versions, nil
+}
+
+// 获取指定版本
+func (b *BinaryHistory) Get(version string) (*BinaryVersion, error) {
+	versions, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrBinaryNotFound, version)
+}
+
+// 二进制文件的完整路径
+func (b *BinaryHistory) Path(v *BinaryVersion) string {
+	return filepath.Join(b.dir, v.File)
+}
+
+// 保存二进制文件，move 为 true 时直接移动源文件（需位于同一文件系统），否则复制
+// 已存在的同版本会被替换，超出数量的旧版本会被删除
+func (b *BinaryHistory) Add(version, src string, move bool) (*BinaryVersion, error) {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return nil, err
+	}
+	entry := &BinaryVersion{
+		Version:     version,
+		File:        "hysteria-" + version,
+		InstalledAt: time.Now(),
+	}
+	dst := b.Path(entry)
+
+	if move {
+		if err := os.Chmod(src, 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return nil, err
+		}
+	} else if err := copyExecutable(src, dst); err != nil {
+		return nil, err
+	}
+
+	sum, size, err := fileSHA256(dst)
+	if err != nil {
+		return nil, err
+	}
+	entry.SHA256 = sum
+	entry.Size = size
+
+	versions, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	kept := []BinaryVersion{*entry}
+	for _, v := range versions {
+		if v.Version == version {
+			continue
+		}
+		if len(kept) >= maxBinaries {
+			os.Remove(b.Path(&v))
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if err := b.save(kept); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// 写入索引，先写临时文件再重命名
+func (b *BinaryHistory) save(versions []BinaryVersion) error {
+	data, err := json.MarshalIndent(versions, "", "    ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(b.dir, binaryHistoryIndex)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// 复制为可执行文件，先写同目录下的临时文件再重命名，保证替换是原子的
+func copyExecutable(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".hysteria-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
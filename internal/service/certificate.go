@@ -0,0 +1,221 @@
+package service
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 默认在证书到期前 14 天提醒
+const DefaultCertWarnDays = 14
+
+// 证书来源
+const (
+	CertSourceHysteria = "hysteria"
+	CertSourceAgent    = "agent"
+)
+
+// 证书状态
+const (
+	CertStatusOK       = "ok"
+	CertStatusWarning  = "warning"  // 即将到期
+	CertStatusExpired  = "expired"  // 已过期
+	CertStatusMismatch = "mismatch" // 私钥与证书不匹配
+	CertStatusError    = "error"    // 无法读取证书或私钥，或证书尚未生效
+)
+
+// hysteria 未配置 acme.dir 时 ACME 证书的保存位置，相对于服务的工作目录
+const defaultACMEDir = "acme"
+
+// 证书信息
+type CertificateInfo struct {
+	Source        string     `json:"source"`           // hysteria 或 agent
+	Domain        string     `json:"domain,omitempty"` // ACME 证书对应的域名
+	Path          string     `json:"path,omitempty"`
+	KeyPath       string     `json:"key_path,omitempty"`
+	Subject       string     `json:"subject,omitempty"`
+	SANs          []string   `json:"sans,omitempty"` // 证书中的域名和 IP
+	Issuer        string     `json:"issuer,omitempty"`
+	SelfSigned    bool       `json:"self_signed"`
+	NotBefore     *time.Time `json:"not_before,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	DaysRemaining int        `json:"days_remaining"` // 距离到期的天数，已过期时为负数
+	SHA256        string     `json:"sha256,omitempty"`
+	KeyMatch      bool       `json:"key_match"` // 私钥是否与证书的公钥匹配
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// 是否应使健康检查失败
+func (c *CertificateInfo) Failed() bool {
+	return c.Status != CertStatusOK && c.Status != CertStatusWarning
+}
+
+// 检查 hysteria 和 agent 自身使用的证书
+type CertificateService struct {
+	hy2Service *Hysteria2Service
+	agentCert  string
+	agentKey   string
+	warnDays   int
+}
+
+func NewCertificateService(agentCert, agentKey string, warnDays int) *CertificateService {
+	if warnDays <= 0 {
+		warnDays = DefaultCertWarnDays
+	}
+	return &CertificateService{
+		hy2Service: NewHysteria2Service(),
+		agentCert:  agentCert,
+		agentKey:   agentKey,
+		warnDays:   warnDays,
+	}
+}
+
+// 到期提醒天数
+func (s *CertificateService) WarnDays() int {
+	return s.warnDays
+}
+
+// 检查所有证书，hysteria 未配置证书时只返回 agent 的证书
+func (s *CertificateService) Inspect() []CertificateInfo {
+	var certs []CertificateInfo
+	if cfg, err := s.hy2Service.GetParsedConfig(); err == nil {
+		switch {
+		case cfg.ACME != nil && len(cfg.ACME.Domains) > 0:
+			for _, domain := range cfg.ACME.Domains {
+				certs = append(certs, s.inspectACME(cfg.ACME, domain))
+			}
+		case cfg.TLS != nil && cfg.TLS.Cert != "":
+			certs = append(certs, s.inspect(CertSourceHysteria, cfg.TLS.Cert, cfg.TLS.Key))
+		}
+	}
+	if s.agentCert != "" {
+		certs = append(certs, s.inspect(CertSourceAgent, s.agentCert, s.agentKey))
+	}
+	return certs
+}
+
+// ACME 证书由 certmagic 保存在 {dir}/certificates/{CA}/{域名}/{域名}.crt，
+// 更换过 CA 时可能存在多个，取到期时间最晚的一个
+func (s *CertificateService) inspectACME(acme *ACMEConfig, domain string) CertificateInfo {
+	dir := acme.Dir
+	if dir == "" {
+		dir = defaultACMEDir
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(hysteriaHomeDir, dir)
+	}
+
+	// 通配符域名的目录名为 wildcard_.example.com
+	name := strings.ToLower(strings.ReplaceAll(domain, "*", "wildcard_"))
+	matches, _ := filepath.Glob(filepath.Join(dir, "certificates", "*", name, name+".crt"))
+
+	var latest *CertificateInfo
+	for _, path := range matches {
+		info := s.inspect(CertSourceHysteria, path, strings.TrimSuffix(path, ".crt")+".key")
+		if latest == nil || (info.NotAfter != nil && (latest.NotAfter == nil || info.NotAfter.After(*latest.NotAfter))) {
+			latest = &info
+		}
+	}
+	if latest == nil {
+		return CertificateInfo{
+			Source: CertSourceHysteria,
+			Domain: domain,
+			Status: CertStatusError,
+			Error:  fmt.Sprintf("no certificate for %s found in %s", domain, dir),
+		}
+	}
+	latest.Domain = domain
+	return *latest
+}
+
+func (s *CertificateService) inspect(source, certPath, keyPath string) CertificateInfo {
+	info := CertificateInfo{Source: source, Path: certPath, KeyPath: keyPath}
+
+	cert, err := loadCertificate(certPath)
+	if err != nil {
+		info.Status = CertStatusError
+		info.Error = err.Error()
+		return info
+	}
+	now := time.Now()
+	info.Subject = cert.Subject.String()
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	info.Issuer = cert.Issuer.String()
+	info.SelfSigned = isSelfSigned(cert)
+	info.NotBefore = &cert.NotBefore
+	info.NotAfter = &cert.NotAfter
+	info.DaysRemaining = int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24))
+	info.SHA256 = certSHA256(cert)
+
+	var keyErr error
+	if keyPath == "" {
+		keyErr = fmt.Errorf("private key is not configured")
+	} else {
+		info.KeyMatch, keyErr = keyMatchesCertificate(cert, keyPath)
+	}
+
+	switch {
+	case now.After(cert.NotAfter):
+		info.Status = CertStatusExpired
+		info.Error = fmt.Sprintf("certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+	case now.Before(cert.NotBefore):
+		info.Status = CertStatusError
+		info.Error = fmt.Sprintf("certificate is not valid before %s", cert.NotBefore.Format(time.RFC3339))
+	case keyErr != nil:
+		info.Status = CertStatusError
+		info.Error = keyErr.Error()
+	case !info.KeyMatch:
+		info.Status = CertStatusMismatch
+		info.Error = fmt.Sprintf("private key %s does not match the certificate", keyPath)
+	case info.DaysRemaining < s.warnDays:
+		info.Status = CertStatusWarning
+		info.Error = fmt.Sprintf("certificate expires in %d days", info.DaysRemaining)
+	default:
+		info.Status = CertStatusOK
+	}
+	return info
+}
+
+// 私钥的公钥部分是否与证书一致，支持 PKCS#8、PKCS#1 和 SEC 1 格式
+func keyMatchesCertificate(cert *x509.Certificate, keyPath string) (bool, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return false, fmt.Errorf("no private key found in %s", keyPath)
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+
+		var key any
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+					return false, fmt.Errorf("failed to parse private key %s", keyPath)
+				}
+			}
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return false, fmt.Errorf("unsupported private key type in %s", keyPath)
+		}
+		pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+		return ok && pub.Equal(cert.PublicKey), nil
+	}
+}
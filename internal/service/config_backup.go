@@ -0,0 +1,496 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	configBackupIndexPath = "/etc/hy2agent/config_backups.json"
+	configBackupPrefix    = "config.yaml.bak."
+	configBackupTimeFmt   = "20060102150405.000000000" // 精确到纳秒，避免同一秒内的备份互相覆盖
+
+	// 对比时表示当前配置
+	LiveConfigName = "current"
+)
+
+var (
+	ErrConfigChanged    = fmt.Errorf("config has been modified")
+	ErrInvalidBackup    = fmt.Errorf("invalid backup file name")
+	ErrBackupNotFound   = fmt.Errorf("backup file not found")
+	ErrBackupPinned     = fmt.Errorf("backup is pinned")
+	ErrInvalidRetention = fmt.Errorf("invalid retention policy")
+)
+
+// 备份保留策略，固定的备份不受限制
+type ConfigBackupRetention struct {
+	MaxCount   int `json:"max_count"`    // 保留的未固定备份数量，0 表示不限
+	MaxAgeDays int `json:"max_age_days"` // 未固定备份的最长保留天数，0 表示不限
+}
+
+var defaultConfigBackupRetention = ConfigBackupRetention{MaxCount: 5}
+
+// 配置备份的元数据，按备份文件名保存在索引中
+type ConfigBackupMeta struct {
+	SHA256    string    `json:"sha256"` // 备份时配置内容的哈希
+	CreatedAt time.Time `json:"created_at"`
+	Label     string    `json:"label,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"`
+}
+
+// 配置备份
+type ConfigBackup struct {
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	SHA256    string    `json:"sha256"`
+	Label     string    `json:"label,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	Pinned    bool      `json:"pinned"`
+}
+
+// 修改备份的标签、备注和固定状态，nil 表示不修改
+type ConfigBackupUpdate struct {
+	Label  *string `json:"label"`
+	Note   *string `json:"note"`
+	Pinned *bool   `json:"pinned"`
+}
+
+// 备份索引文件
+type configBackupIndex struct {
+	Retention ConfigBackupRetention        `json:"retention"`
+	Backups   map[string]*ConfigBackupMeta `json:"backups"`
+}
+
+// 配置内容的哈希，用作 ETag
+func ConfigHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 获取当前配置的哈希
+func (h *Hysteria2Service) GetConfigHash() (string, error) {
+	data, err := os.ReadFile(hysteriaConfigPath)
+	if err != nil {
+		return "", err
+	}
+	return ConfigHash(data), nil
+}
+
+// 检查当前配置的哈希是否为 hashes 之一，否则返回 ErrConfigChanged，同时返回当前哈希
+func (h *Hysteria2Service) MatchConfigHash(hashes []string) (string, error) {
+	current, err := h.GetConfigHash()
+	if err != nil {
+		return "", err
+	}
+	for _, hash := range hashes {
+		if hash == current {
+			return current, nil
+		}
+	}
+	return current, fmt.Errorf("%w: current hash is %s", ErrConfigChanged, current)
+}
+
+// 备份配置，并按保留策略清理旧备份
+func (h *Hysteria2Service) BackupConfig() (string, error) {
+	return h.backupConfig("")
+}
+
+// 备份配置，keep 指定的备份不参与本次清理
+func (h *Hysteria2Service) backupConfig(keep string) (string, error) {
+	// 读取当前配置
+	data, err := os.ReadFile(hysteriaConfigPath)
+	if err != nil {
+		return "", err
+	}
+
+	// 生成备份文件名（带时间戳）
+	now := time.Now()
+	name := configBackupPrefix + now.Format(configBackupTimeFmt)
+	backupPath := filepath.Join(hysteriaConfigDir, name)
+
+	// 写入备份文件，同名文件已存在时不覆盖
+	if err := writeNewFile(backupPath, data, 0644); err != nil {
+		if os.IsExist(err) {
+			return "", fmt.Errorf("backup %s already exists", name)
+		}
+		return "", err
+	}
+
+	// 记录备份时配置的哈希
+	index, err := loadConfigBackupIndex()
+	if err != nil {
+		return "", fmt.Errorf("failed to record backup: %v", err)
+	}
+	index.Backups[name] = &ConfigBackupMeta{
+		SHA256:    ConfigHash(data),
+		CreatedAt: now,
+	}
+
+	if err := h.pruneConfigBackups(index, now, keep); err != nil {
+		return "", fmt.Errorf("failed to record backup: %v", err)
+	}
+	return backupPath, nil
+}
+
+// 获取配置备份列表，按时间倒序排列
+func (h *Hysteria2Service) GetConfigBackups() ([]ConfigBackup, error) {
+	index, err := loadConfigBackupIndex()
+	if err != nil {
+		return nil, err
+	}
+	return listConfigBackups(index)
+}
+
+// 获取单个备份的信息和内容
+func (h *Hysteria2Service) GetConfigBackup(name string) (*ConfigBackup, []byte, error) {
+	if err := checkBackupName(name); err != nil {
+		return nil, nil, err
+	}
+	index, err := loadConfigBackupIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(hysteriaConfigDir, name))
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrBackupNotFound, name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backup := newConfigBackup(name, int64(len(data)), index.Backups[name])
+	if backup.SHA256 == "" {
+		backup.SHA256 = ConfigHash(data)
+	}
+	if backup.CreatedAt.IsZero() {
+		if info, err := os.Stat(filepath.Join(hysteriaConfigDir, name)); err == nil {
+			backup.CreatedAt = backupCreatedAt(name, info.ModTime())
+		}
+	}
+	return backup, data, nil
+}
+
+// 修改备份的标签、备注和固定状态
+func (h *Hysteria2Service) UpdateConfigBackup(ctx context.Context, name string, update *ConfigBackupUpdate) (*ConfigBackup, error) {
+	lease, _, err := BeginOperation(ctx, "update_backup")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	if _, _, err := h.GetConfigBackup(name); err != nil {
+		return nil, err
+	}
+	index, err := loadConfigBackupIndex()
+	if err != nil {
+		return nil, err
+	}
+	meta := index.Backups[name]
+	if meta == nil {
+		meta = &ConfigBackupMeta{}
+		index.Backups[name] = meta
+	}
+	if update.Label != nil {
+		meta.Label = strings.TrimSpace(*update.Label)
+	}
+	if update.Note != nil {
+		meta.Note = *update.Note
+	}
+	if update.Pinned != nil {
+		meta.Pinned = *update.Pinned
+	}
+
+	// 取消固定后可能超出保留策略
+	if err := h.pruneConfigBackups(index, time.Now(), ""); err != nil {
+		return nil, err
+	}
+	backup, _, err := h.GetConfigBackup(name)
+	if errors.Is(err, ErrBackupNotFound) {
+		return nil, fmt.Errorf("%w: %s was pruned by the retention policy", ErrBackupNotFound, name)
+	}
+	return backup, err
+}
+
+// 删除备份，固定的备份需要先取消固定
+func (h *Hysteria2Service) DeleteConfigBackup(ctx context.Context, name string) error {
+	lease, _, err := BeginOperation(ctx, "delete_backup")
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	if _, _, err := h.GetConfigBackup(name); err != nil {
+		return err
+	}
+	index, err := loadConfigBackupIndex()
+	if err != nil {
+		return err
+	}
+	if meta := index.Backups[name]; meta != nil && meta.Pinned {
+		return fmt.Errorf("%w: unpin %s before deleting it", ErrBackupPinned, name)
+	}
+	if err := os.Remove(filepath.Join(hysteriaConfigDir, name)); err != nil {
+		return err
+	}
+	delete(index.Backups, name)
+	return saveConfigBackupIndex(index)
+}
+
+// 获取备份保留策略
+func (h *Hysteria2Service) GetConfigBackupRetention() (*ConfigBackupRetention, error) {
+	index, err := loadConfigBackupIndex()
+	if err != nil {
+		return nil, err
+	}
+	return &index.Retention, nil
+}
+
+// 修改备份保留策略，并立即清理超出策略的备份
+func (h *Hysteria2Service) SetConfigBackupRetention(ctx context.Context, retention *ConfigBackupRetention) ([]string, error) {
+	if retention.MaxCount < 0 || retention.MaxAgeDays < 0 {
+		return nil, fmt.Errorf("%w: max_count and max_age_days must not be negative", ErrInvalidRetention)
+	}
+	if retention.MaxCount == 0 && retention.MaxAgeDays == 0 {
+		return nil, fmt.Errorf("%w: at least one of max_count and max_age_days is required", ErrInvalidRetention)
+	}
+
+	lease, _, err := BeginOperation(ctx, "update_backup_retention")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	index, err := loadConfigBackupIndex()
+	if err != nil {
+		return nil, err
+	}
+	before, err := listConfigBackups(index)
+	if err != nil {
+		return nil, err
+	}
+	index.Retention = *retention
+	if err := h.pruneConfigBackups(index, time.Now(), ""); err != nil {
+		return nil, err
+	}
+
+	// 返回被清理的备份
+	removed := make([]string, 0)
+	for _, backup := range before {
+		if _, ok := index.Backups[backup.Filename]; !ok {
+			removed = append(removed, backup.Filename)
+		}
+	}
+	return removed, nil
+}
+
+// 生成两个备份之间，或备份与当前配置之间的 diff
+// 名称为空或 "current" 时表示当前配置
+func (h *Hysteria2Service) DiffConfigBackups(from, to string) (string, error) {
+	fromName, fromData, err := h.readConfigVersion(from)
+	if err != nil {
+		return "", err
+	}
+	toName, toData, err := h.readConfigVersion(to)
+	if err != nil {
+		return "", err
+	}
+	return UnifiedDiff(fromName, toName, fromData, toData), nil
+}
+
+func (h *Hysteria2Service) readConfigVersion(name string) (string, []byte, error) {
+	if name == "" || name == LiveConfigName {
+		data, err := os.ReadFile(hysteriaConfigPath)
+		return LiveConfigName, data, err
+	}
+	_, data, err := h.GetConfigBackup(name)
+	return name, data, err
+}
+
+// 恢复配置备份，与更新配置相同，先备份当前配置，恢复后服务无法启动时回滚
+// 备份当前配置时触发的清理不会删除正在恢复的备份
+func (h *Hysteria2Service) RestoreConfig(ctx context.Context, backup string) (*ConfigApplyResult, error) {
+	lease, ctx, err := BeginOperation(ctx, "restore_config")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	meta, data, err := h.GetConfigBackup(backup)
+	if err != nil {
+		return nil, err
+	}
+	return h.applyConfigKeeping(ctx, data, meta.Filename)
+}
+
+// 按保留策略删除未固定的旧备份，最新的备份和 keep 指定的备份总是保留，随后保存索引
+// 索引中已不存在的备份文件的记录同时被删除
+func (h *Hysteria2Service) pruneConfigBackups(index *configBackupIndex, now time.Time, keep string) error {
+	backups, err := listConfigBackups(index)
+	if err != nil {
+		return err
+	}
+
+	retention := index.Retention
+	kept := make(map[string]*ConfigBackupMeta, len(backups))
+	unpinned := 0
+	for i, backup := range backups {
+		meta := index.Backups[backup.Filename]
+		if meta == nil {
+			meta = &ConfigBackupMeta{}
+		}
+		// 补全没有记录的备份的哈希和时间
+		if meta.SHA256 == "" {
+			meta.SHA256 = backup.SHA256
+		}
+		if meta.CreatedAt.IsZero() {
+			meta.CreatedAt = backup.CreatedAt
+		}
+		if !backup.Pinned && i > 0 && backup.Filename != keep {
+			expired := retention.MaxAgeDays > 0 &&
+				now.Sub(backup.CreatedAt) > time.Duration(retention.MaxAgeDays)*24*time.Hour
+			if expired || retention.MaxCount > 0 && unpinned >= retention.MaxCount {
+				os.Remove(filepath.Join(hysteriaConfigDir, backup.Filename))
+				continue
+			}
+		}
+		if !backup.Pinned {
+			unpinned++
+		}
+		kept[backup.Filename] = meta
+	}
+
+	index.Backups = kept
+	return saveConfigBackupIndex(index)
+}
+
+// 列出备份目录中的备份文件并合并索引中的元数据，按时间倒序排列
+// 没有记录的备份（如手动创建的）使用文件名中的时间，并即时计算哈希
+func listConfigBackups(index *configBackupIndex) ([]ConfigBackup, error) {
+	files, err := os.ReadDir(hysteriaConfigDir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]ConfigBackup, 0)
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, configBackupPrefix) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		backup := newConfigBackup(name, info.Size(), index.Backups[name])
+		if backup.CreatedAt.IsZero() {
+			backup.CreatedAt = backupCreatedAt(name, info.ModTime())
+		}
+		if backup.SHA256 == "" {
+			if data, err := os.ReadFile(filepath.Join(hysteriaConfigDir, name)); err == nil {
+				backup.SHA256 = ConfigHash(data)
+			}
+		}
+		backups = append(backups, *backup)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].CreatedAt.Equal(backups[j].CreatedAt) {
+			return backups[i].CreatedAt.After(backups[j].CreatedAt)
+		}
+		return backups[i].Filename > backups[j].Filename
+	})
+	return backups, nil
+}
+
+func newConfigBackup(name string, size int64, meta *ConfigBackupMeta) *ConfigBackup {
+	backup := &ConfigBackup{Filename: name, Size: size}
+	if meta != nil {
+		backup.CreatedAt = meta.CreatedAt
+		backup.SHA256 = meta.SHA256
+		backup.Label = meta.Label
+		backup.Note = meta.Note
+		backup.Pinned = meta.Pinned
+	}
+	return backup
+}
+
+// 没有记录的备份优先使用文件名中的时间，无法解析时使用修改时间
+// 旧版本的文件名只精确到秒，按秒解析，纳秒部分作为小数秒同样可以解析
+func backupCreatedAt(name string, modTime time.Time) time.Time {
+	if t, err := time.ParseInLocation("20060102150405", strings.TrimPrefix(name, configBackupPrefix), time.Local); err == nil {
+		return t
+	}
+	return modTime
+}
+
+// 创建并写入文件，文件已存在时返回 os.ErrExist
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// 安全检查：确保文件名是备份文件，且不包含路径
+func checkBackupName(name string) error {
+	if !strings.HasPrefix(name, configBackupPrefix) || filepath.Base(name) != name {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, name)
+	}
+	return nil
+}
+
+// 读取备份索引，不存在时返回默认保留策略和空记录
+func loadConfigBackupIndex() (*configBackupIndex, error) {
+	index := &configBackupIndex{
+		Retention: defaultConfigBackupRetention,
+		Backups:   make(map[string]*ConfigBackupMeta),
+	}
+	data, err := os.ReadFile(configBackupIndexPath)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, err
+	}
+	if index.Backups == nil {
+		index.Backups = make(map[string]*ConfigBackupMeta)
+	}
+	return index, nil
+}
+
+// 写入备份索引，先写临时文件再重命名
+func saveConfigBackupIndex(index *configBackupIndex) error {
+	if err := os.MkdirAll(filepath.Dir(configBackupIndexPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmpPath := configBackupIndexPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, configBackupIndexPath)
+}
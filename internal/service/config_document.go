@@ -0,0 +1,591 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置补丁格式
+const (
+	ConfigPatchMerge = "merge" // RFC 7396 JSON Merge Patch
+	ConfigPatchJSON  = "json"  // RFC 6902 JSON Patch
+)
+
+var ErrInvalidConfigPatch = fmt.Errorf("invalid config patch")
+
+// 基于 yaml.v3 节点树的配置文档，修改时保留注释、字段顺序和格式
+// agent 对配置的所有结构化修改都通过它完成，不再经过结构体序列化
+type ConfigDocument struct {
+	root   *yaml.Node // 顶层映射节点
+	doc    *yaml.Node // 文档节点，保存文件开头和结尾的注释
+	indent int
+}
+
+// 解析配置文档，空文件视为空映射
+func ParseConfigDocument(data []byte) (*ConfigDocument, error) {
+	d := &ConfigDocument{indent: detectIndent(data)}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse config: top level must be a mapping")
+	}
+	d.doc = &doc
+	d.root = doc.Content[0]
+	return d, nil
+}
+
+// 读取当前配置文档
+func (h *Hysteria2Service) GetConfigDocument() (*ConfigDocument, error) {
+	data, err := os.ReadFile(hysteriaConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfigDocument(data)
+}
+
+// 序列化为 YAML，缩进与原文件一致
+func (d *ConfigDocument) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(d.indent)
+	if err := enc.Encode(d.doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 解析为结构体，用于读取字段和检查类型
+func (d *ConfigDocument) Config() (*Hysteria2Config, error) {
+	var cfg Hysteria2Config
+	if err := d.root.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// 设置映射路径上的值，中间的映射不存在时自动创建
+// 已存在的值被替换，键和值上的注释保留
+func (d *ConfigDocument) Set(value interface{}, path ...string) error {
+	node, err := valueNode(value)
+	if err != nil {
+		return err
+	}
+	parent := d.root
+	for _, key := range path[:len(path)-1] {
+		child := mappingValue(parent, key)
+		if child == nil || child.Kind != yaml.MappingNode {
+			setMappingValue(parent, key, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			child = mappingValue(parent, key)
+		}
+		parent = child
+	}
+	setMappingValue(parent, path[len(path)-1], node)
+	return nil
+}
+
+// 删除映射路径上的值，不存在时忽略
+func (d *ConfigDocument) Delete(path ...string) {
+	parent := d.root
+	for _, key := range path[:len(path)-1] {
+		parent = mappingValue(parent, key)
+		if parent == nil || parent.Kind != yaml.MappingNode {
+			return
+		}
+	}
+	deleteMappingValue(parent, path[len(path)-1])
+}
+
+// 按 RFC 7396 (JSON Merge Patch) 修改 path 处的值，path 为空时修改整个配置
+// 对象逐个字段合并，null 删除字段，其他值整体替换
+func (d *ConfigDocument) MergePatch(patch []byte, path ...string) error {
+	value, err := decodePatchJSON(patch)
+	if err != nil {
+		return err
+	}
+
+	if len(path) == 0 {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: merge patch for the whole config must be an object", ErrInvalidConfigPatch)
+		}
+		return mergeMapping(d.root, obj)
+	}
+
+	parent := d.root
+	for _, key := range path[:len(path)-1] {
+		child := mappingValue(parent, key)
+		if child == nil || child.Kind != yaml.MappingNode {
+			setMappingValue(parent, key, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			child = mappingValue(parent, key)
+		}
+		parent = child
+	}
+	return mergeField(parent, path[len(path)-1], value)
+}
+
+// 按 RFC 6902 (JSON Patch) 依次执行操作，任一操作失败时返回错误，文档内容不再可用
+func (d *ConfigDocument) JSONPatch(patch []byte) error {
+	var ops []struct {
+		Op    string           `json:"op"`
+		Path  *string          `json:"path"`
+		From  *string          `json:"from"`
+		Value *json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfigPatch, err)
+	}
+
+	for i, op := range ops {
+		if op.Path == nil {
+			return fmt.Errorf("%w: operation %d: path is required", ErrInvalidConfigPatch, i)
+		}
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return fmt.Errorf("%w: operation %d: %v", ErrInvalidConfigPatch, i, err)
+		}
+
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return fmt.Errorf("%w: operation %d: value is required", ErrInvalidConfigPatch, i)
+			}
+			if value, err = decodePatchJSON(*op.Value); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return fmt.Errorf("%w: operation %d: from is required", ErrInvalidConfigPatch, i)
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			err = d.pointerAdd(path, value)
+		case "remove":
+			_, err = d.pointerRemove(path)
+		case "replace":
+			err = d.pointerReplace(path, value)
+		case "move", "copy":
+			var from []string
+			if from, err = parsePointer(*op.From); err != nil {
+				break
+			}
+			var node *yaml.Node
+			if op.Op == "move" {
+				if isPointerPrefix(from, path) && len(from) < len(path) {
+					err = fmt.Errorf("cannot move %s into itself", *op.From)
+					break
+				}
+				node, err = d.pointerRemove(from)
+			} else {
+				var src *yaml.Node
+				if src, err = d.pointerGet(from); err == nil {
+					node = copyNode(src)
+				}
+			}
+			if err == nil {
+				err = d.pointerAddNode(path, node)
+			}
+		case "test":
+			var node *yaml.Node
+			if node, err = d.pointerGet(path); err == nil {
+				var actual interface{}
+				if err = node.Decode(&actual); err == nil && !jsonEqual(actual, value) {
+					err = fmt.Errorf("test failed at %s", *op.Path)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: operation %d (%s %s): %v", ErrInvalidConfigPatch, i, op.Op, *op.Path, err)
+		}
+	}
+	return nil
+}
+
+// 在当前配置上应用补丁，返回修改后的完整配置，不写入文件
+// format 为 ConfigPatchMerge (RFC 7396) 或 ConfigPatchJSON (RFC 6902)
+func (h *Hysteria2Service) PatchedConfig(format string, patch []byte) ([]byte, error) {
+	doc, err := h.GetConfigDocument()
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case ConfigPatchMerge:
+		err = doc.MergePatch(patch)
+	case ConfigPatchJSON:
+		err = doc.JSONPatch(patch)
+	default:
+		err = fmt.Errorf("%w: unknown patch format %q", ErrInvalidConfigPatch, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := doc.Config(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigPatch, err)
+	}
+	return doc.Bytes()
+}
+
+// 获取 JSON 指针指向的节点
+func (d *ConfigDocument) pointerGet(path []string) (*yaml.Node, error) {
+	node := d.root
+	for i, token := range path {
+		child, err := childNode(node, token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", formatPointer(path[:i+1]), err)
+		}
+		node = child
+	}
+	return node, nil
+}
+
+func (d *ConfigDocument) pointerAdd(path []string, value interface{}) error {
+	node, err := valueNode(value)
+	if err != nil {
+		return err
+	}
+	return d.pointerAddNode(path, node)
+}
+
+// 映射中添加或替换字段，列表中在指定位置插入，"-" 表示追加到末尾
+func (d *ConfigDocument) pointerAddNode(path []string, node *yaml.Node) error {
+	if len(path) == 0 {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("the whole config must be a mapping")
+		}
+		replaceNode(d.root, node)
+		return nil
+	}
+	parent, err := d.pointerGet(path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	token := path[len(path)-1]
+	switch parent.Kind {
+	case yaml.MappingNode:
+		setMappingValue(parent, token, node)
+	case yaml.SequenceNode:
+		index := len(parent.Content)
+		if token != "-" {
+			if index, err = sequenceIndex(token, len(parent.Content)+1); err != nil {
+				return err
+			}
+		}
+		parent.Content = append(parent.Content[:index], append([]*yaml.Node{node}, parent.Content[index:]...)...)
+	default:
+		return fmt.Errorf("%s is not a mapping or list", formatPointer(path[:len(path)-1]))
+	}
+	return nil
+}
+
+func (d *ConfigDocument) pointerReplace(path []string, value interface{}) error {
+	node, err := valueNode(value)
+	if err != nil {
+		return err
+	}
+	target, err := d.pointerGet(path)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 && node.Kind != yaml.MappingNode {
+		return fmt.Errorf("the whole config must be a mapping")
+	}
+	replaceNode(target, node)
+	return nil
+}
+
+// 删除并返回指针指向的节点
+func (d *ConfigDocument) pointerRemove(path []string) (*yaml.Node, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole config")
+	}
+	parent, err := d.pointerGet(path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch parent.Kind {
+	case yaml.MappingNode:
+		node := mappingValue(parent, token)
+		if node == nil {
+			return nil, fmt.Errorf("%s does not exist", formatPointer(path))
+		}
+		deleteMappingValue(parent, token)
+		return node, nil
+	case yaml.SequenceNode:
+		index, err := sequenceIndex(token, len(parent.Content))
+		if err != nil {
+			return nil, err
+		}
+		node := parent.Content[index]
+		parent.Content = append(parent.Content[:index], parent.Content[index+1:]...)
+		return node, nil
+	}
+	return nil, fmt.Errorf("%s is not a mapping or list", formatPointer(path[:len(path)-1]))
+}
+
+// 把对象合并到映射节点
+func mergeMapping(node *yaml.Node, patch map[string]interface{}) error {
+	for _, key := range sortedKeys(patch) {
+		if err := mergeField(node, key, patch[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mergeField(parent *yaml.Node, key string, value interface{}) error {
+	if value == nil {
+		deleteMappingValue(parent, key)
+		return nil
+	}
+	if obj, ok := value.(map[string]interface{}); ok {
+		existing := mappingValue(parent, key)
+		if existing == nil || existing.Kind != yaml.MappingNode {
+			// 新建的对象同样去掉其中的 null
+			// 替换已有的值时节点被原地改写，需要重新取出树中的节点再合并
+			setMappingValue(parent, key, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			existing = mappingValue(parent, key)
+		}
+		return mergeMapping(existing, obj)
+	}
+	node, err := valueNode(value)
+	if err != nil {
+		return err
+	}
+	setMappingValue(parent, key, node)
+	return nil
+}
+
+// 映射中某个键的值，不存在时返回 nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// 设置映射中某个键的值，已存在时原地替换以保留位置和注释，否则追加到末尾
+// 原地替换时 value 被复制到已有节点中，之后需要通过 mappingValue 取得树中的节点
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			replaceNode(node.Content[i+1], value)
+			return
+		}
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		value,
+	)
+}
+
+func deleteMappingValue(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// 用新值替换节点内容，新值没有注释时沿用原节点的注释
+// 标量之间的替换同时保留原来的引号风格
+func replaceNode(target, value *yaml.Node) {
+	replaced := *value
+	if replaced.HeadComment == "" {
+		replaced.HeadComment = target.HeadComment
+	}
+	if replaced.LineComment == "" {
+		replaced.LineComment = target.LineComment
+	}
+	if replaced.FootComment == "" {
+		replaced.FootComment = target.FootComment
+	}
+	if target.Kind == yaml.ScalarNode && replaced.Kind == yaml.ScalarNode && replaced.Tag == "!!str" &&
+		(target.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle)) != 0 {
+		replaced.Style = target.Style
+	}
+	*target = replaced
+}
+
+// 列表或映射中的子节点
+func childNode(node *yaml.Node, token string) (*yaml.Node, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if child := mappingValue(node, token); child != nil {
+			return child, nil
+		}
+		return nil, fmt.Errorf("does not exist")
+	case yaml.SequenceNode:
+		index, err := sequenceIndex(token, len(node.Content))
+		if err != nil {
+			return nil, err
+		}
+		return node.Content[index], nil
+	}
+	return nil, fmt.Errorf("parent is not a mapping or list")
+}
+
+// 列表下标，必须小于 limit
+func sequenceIndex(token string, limit int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid list index %q", token)
+	}
+	if index >= limit {
+		return 0, fmt.Errorf("list index %d out of range", index)
+	}
+	return index, nil
+}
+
+// 解析 JSON 指针（RFC 6901）
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func formatPointer(path []string) string {
+	var b strings.Builder
+	for _, token := range path {
+		b.WriteString("/")
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+func isPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 把值编码为节点，映射按键排序
+func valueNode(value interface{}) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// 解析补丁中的 JSON 值，整数保持为整数，避免写成浮点数
+func decodePatchJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigPatch, err)
+	}
+	return normalizeJSONNumbers(value), nil
+}
+
+func normalizeJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalizeJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeJSONNumbers(item)
+		}
+	}
+	return value
+}
+
+// 按 JSON 语义比较两个值
+func jsonEqual(a, b interface{}) bool {
+	var na, nb interface{}
+	da, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	if json.Unmarshal(da, &na) != nil || json.Unmarshal(db, &nb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 原文件的缩进宽度，取第一个缩进行的空格数，默认 2
+func detectIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); indent >= 2 && indent <= 8 {
+			return indent
+		}
+		break
+	}
+	return 2
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 解析 JSON 形式的文档，JSON 同时也是合法的 YAML
+func mustParseDocument(t *testing.T, data string) *ConfigDocument {
+	t.Helper()
+	doc, err := ParseConfigDocument([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseConfigDocument(%s): %v", data, err)
+	}
+	return doc
+}
+
+// 序列化后重新解析，与期望的 JSON 按值比较
+func assertDocument(t *testing.T, doc *ConfigDocument, want string) {
+	t.Helper()
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes(): %v", err)
+	}
+	reparsed, err := ParseConfigDocument(data)
+	if err != nil {
+		t.Fatalf("reparse %q: %v", data, err)
+	}
+	var got, expected interface{}
+	if err := reparsed.root.Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if err := json.Unmarshal([]byte(want), &expected); err != nil {
+		t.Fatalf("bad expectation %s: %v", want, err)
+	}
+	if got == nil {
+		got = map[string]interface{}{}
+	}
+	if !jsonEqual(got, expected) {
+		gotJSON, _ := json.Marshal(got)
+		t.Errorf("document = %s, want %s", gotJSON, want)
+	}
+}
+
+// RFC 7396 附录 A 的示例
+var mergePatchExamples = []struct {
+	target, patch, result string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestMergePatchRFC7396(t *testing.T) {
+	for _, ex := range mergePatchExamples {
+		// 整个配置必须是映射，因此只有对象之间的示例直接作用于文档
+		if !strings.HasPrefix(ex.target, "{") || !strings.HasPrefix(ex.patch, "{") {
+			continue
+		}
+		t.Run(ex.patch, func(t *testing.T) {
+			doc := mustParseDocument(t, ex.target)
+			if err := doc.MergePatch([]byte(ex.patch)); err != nil {
+				t.Fatalf("MergePatch: %v", err)
+			}
+			assertDocument(t, doc, ex.result)
+		})
+	}
+}
+
+func TestMergePatchRFC7396AtPath(t *testing.T) {
+	// 所有示例都放在 x 字段下，通过 path 修改，结果为 null 时字段被删除
+	for _, ex := range mergePatchExamples {
+		t.Run(ex.target+" "+ex.patch, func(t *testing.T) {
+			doc := mustParseDocument(t, `{"x":`+ex.target+`,"keep":1}`)
+			if err := doc.MergePatch([]byte(ex.patch), "x"); err != nil {
+				t.Fatalf("MergePatch: %v", err)
+			}
+			want := `{"x":` + ex.result + `,"keep":1}`
+			if ex.result == "null" {
+				want = `{"keep":1}`
+			}
+			assertDocument(t, doc, want)
+		})
+	}
+}
+
+func TestMergePatchReplacesScalarOnPath(t *testing.T) {
+	doc := mustParseDocument(t, `{"obfs":"none","listen":":443"}`)
+	if err := doc.MergePatch([]byte(`{"password":"secret"}`), "obfs", "salamander"); err != nil {
+		t.Fatalf("MergePatch: %v", err)
+	}
+	assertDocument(t, doc, `{"obfs":{"salamander":{"password":"secret"}},"listen":":443"}`)
+}
+
+func TestSetReplacesScalarOnPath(t *testing.T) {
+	doc := mustParseDocument(t, `{"trafficStats":"off"}`)
+	if err := doc.Set("127.0.0.1:18990", "trafficStats", "listen"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	assertDocument(t, doc, `{"trafficStats":{"listen":"127.0.0.1:18990"}}`)
+}
+
+func TestMergePatchRejectsNonObjectForWholeConfig(t *testing.T) {
+	doc := mustParseDocument(t, `{"a":"b"}`)
+	if err := doc.MergePatch([]byte(`["c"]`)); !errors.Is(err, ErrInvalidConfigPatch) {
+		t.Errorf("MergePatch(array) error = %v, want ErrInvalidConfigPatch", err)
+	}
+}
+
+func TestMergePatchPreservesComments(t *testing.T) {
+	const config = `# 主端口
+listen: :443
+
+auth:
+    type: password
+    password: old # 管理员密码
+
+masquerade:
+    type: proxy
+`
+	doc := mustParseDocument(t, config)
+	if err := doc.MergePatch([]byte(`{"auth":{"password":"new"}}`)); err != nil {
+		t.Fatalf("MergePatch: %v", err)
+	}
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes(): %v", err)
+	}
+	out := string(data)
+	for _, want := range []string{"# 主端口\n", "password: new # 管理员密码\n", "    type: password\n", "masquerade:\n    type: proxy\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lost %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "listen:") > strings.Index(out, "auth:") || strings.Index(out, "auth:") > strings.Index(out, "masquerade:") {
+		t.Errorf("field order changed:\n%s", out)
+	}
+}
+
+// RFC 6902 附录 A 的示例，error 为 true 时补丁应当失败
+var jsonPatchExamples = []struct {
+	name                  string
+	target, patch, result string
+	error                 bool
+}{
+	{
+		name:   "A.1 adding an object member",
+		target: `{"foo":"bar"}`,
+		patch:  `[{"op":"add","path":"/baz","value":"qux"}]`,
+		result: `{"baz":"qux","foo":"bar"}`,
+	},
+	{
+		name:   "A.2 adding an array element",
+		target: `{"foo":["bar","baz"]}`,
+		patch:  `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+		result: `{"foo":["bar","qux","baz"]}`,
+	},
+	{
+		name:   "A.3 removing an object member",
+		target: `{"baz":"qux","foo":"bar"}`,
+		patch:  `[{"op":"remove","path":"/baz"}]`,
+		result: `{"foo":"bar"}`,
+	},
+	{
+		name:   "A.4 removing an array element",
+		target: `{"foo":["bar","qux","baz"]}`,
+		patch:  `[{"op":"remove","path":"/foo/1"}]`,
+		result: `{"foo":["bar","baz"]}`,
+	},
+	{
+		name:   "A.5 replacing a value",
+		target: `{"baz":"qux","foo":"bar"}`,
+		patch:  `[{"op":"replace","path":"/baz","value":"boo"}]`,
+		result: `{"baz":"boo","foo":"bar"}`,
+	},
+	{
+		name:   "A.6 moving a value",
+		target: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+		patch:  `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+		result: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+	},
+	{
+		name:   "A.7 moving an array element",
+		target: `{"foo":["all","grass","cows","eat"]}`,
+		patch:  `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+		result: `{"foo":["all","cows","eat","grass"]}`,
+	},
+	{
+		name:   "A.8 testing a value: success",
+		target: `{"baz":"qux","foo":["a",2,"c"]}`,
+		patch:  `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+		result: `{"baz":"qux","foo":["a",2,"c"]}`,
+	},
+	{
+		name:   "A.9 testing a value: error",
+		target: `{"baz":"qux"}`,
+		patch:  `[{"op":"test","path":"/baz","value":"bar"}]`,
+		error:  true,
+	},
+	{
+		name:   "A.10 adding a nested member object",
+		target: `{"foo":"bar"}`,
+		patch:  `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+		result: `{"foo":"bar","child":{"grandchild":{}}}`,
+	},
+	{
+		name:   "A.11 ignoring unrecognized elements",
+		target: `{"foo":"bar"}`,
+		patch:  `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+		result: `{"foo":"bar","baz":"qux"}`,
+	},
+	{
+		name:   "A.12 adding to a nonexistent target",
+		target: `{"foo":"bar"}`,
+		patch:  `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+		error:  true,
+	},
+	{
+		name:   "A.14 ~ escape ordering",
+		target: `{"/":9,"~1":10}`,
+		patch:  `[{"op":"test","path":"/~01","value":10}]`,
+		result: `{"/":9,"~1":10}`,
+	},
+	{
+		name:   "A.15 comparing strings and numbers",
+		target: `{"/":9,"~1":10}`,
+		patch:  `[{"op":"test","path":"/~01","value":"10"}]`,
+		error:  true,
+	},
+	{
+		name:   "A.16 adding an array value",
+		target: `{"foo":["bar"]}`,
+		patch:  `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+		result: `{"foo":["bar",["abc","def"]]}`,
+	},
+	{
+		name:   "copying a value",
+		target: `{"foo":{"bar":1},"baz":{}}`,
+		patch:  `[{"op":"copy","from":"/foo/bar","path":"/baz/bar"}]`,
+		result: `{"foo":{"bar":1},"baz":{"bar":1}}`,
+	},
+	{
+		name:   "moving a value into itself",
+		target: `{"foo":{"bar":1}}`,
+		patch:  `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`,
+		error:  true,
+	},
+	{
+		name:   "removing a missing member",
+		target: `{"foo":"bar"}`,
+		patch:  `[{"op":"remove","path":"/baz"}]`,
+		error:  true,
+	},
+	{
+		name:   "unknown op",
+		target: `{"foo":"bar"}`,
+		patch:  `[{"op":"merge","path":"/foo","value":1}]`,
+		error:  true,
+	},
+}
+
+func TestJSONPatchRFC6902(t *testing.T) {
+	for _, ex := range jsonPatchExamples {
+		t.Run(ex.name, func(t *testing.T) {
+			doc := mustParseDocument(t, ex.target)
+			err := doc.JSONPatch([]byte(ex.patch))
+			if ex.error {
+				if !errors.Is(err, ErrInvalidConfigPatch) {
+					t.Fatalf("JSONPatch error = %v, want ErrInvalidConfigPatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JSONPatch: %v", err)
+			}
+			assertDocument(t, doc, ex.result)
+		})
+	}
+}
+
+func TestJSONPatchKeepsIntegers(t *testing.T) {
+	doc := mustParseDocument(t, "quic:\n  maxIdleTimeout: 30s\n")
+	if err := doc.JSONPatch([]byte(`[{"op":"add","path":"/quic/initStreamReceiveWindow","value":8388608}]`)); err != nil {
+		t.Fatalf("JSONPatch: %v", err)
+	}
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes(): %v", err)
+	}
+	if !strings.Contains(string(data), "initStreamReceiveWindow: 8388608\n") {
+		t.Errorf("integer was not preserved:\n%s", data)
+	}
+}
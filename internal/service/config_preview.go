@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置变更类型
+const (
+	ConfigChangeAdded   = "added"
+	ConfigChangeChanged = "changed"
+	ConfigChangeRemoved = "removed"
+)
+
+const maskedSecret = "******"
+
+// 字段名包含这些词时视为密钥，如 password、secret、token、apiKey、secretAccessKey
+var secretConfigKeywords = []string{"password", "secret", "token", "key"}
+
+// 单个字段的变更，密钥字段的值被遮盖
+type ConfigChange struct {
+	Path string      `json:"path"` // 字段路径，如 "auth.password"
+	Type string      `json:"type"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// 配置变更预览
+type ConfigPreview struct {
+	Changed         bool              `json:"changed"`          // 文本内容是否有变化
+	RequiresRestart bool              `json:"requires_restart"` // 是否需要重启服务才能生效
+	Diff            string            `json:"diff"`             // 统一格式的文本 diff，密钥字段已遮盖，任一方无法解析时为空
+	Changes         []ConfigChange    `json:"changes"`          // 按字段的变更，任一方无法解析时为空
+	Validation      *ConfigValidation `json:"validation"`       // 候选配置的校验结果
+}
+
+// 预览完整配置替换后的变更，不写入任何内容
+func (h *Hysteria2Service) PreviewConfig(candidate []byte) (*ConfigPreview, error) {
+	live, err := os.ReadFile(hysteriaConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return h.previewConfig(live, candidate), nil
+}
+
+// 预览修改单个配置段后的变更，不写入任何内容
+func (h *Hysteria2Service) PreviewConfigSection(name string, patch []byte) (*ConfigPreview, error) {
+	live, err := os.ReadFile(hysteriaConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	_, candidate, err := h.PatchedConfigSection(name, patch)
+	if err != nil {
+		return nil, err
+	}
+	return h.previewConfig(live, candidate), nil
+}
+
+func (h *Hysteria2Service) previewConfig(live, candidate []byte) *ConfigPreview {
+	preview := &ConfigPreview{
+		Changed:    !bytes.Equal(live, candidate),
+		Changes:    []ConfigChange{},
+		Validation: h.ValidateConfig(string(candidate)),
+	}
+
+	// 文本 diff 同样不能泄露密钥，两边都遮盖后重新序列化再比较，格式一致时只显示实际变化的行
+	// 无法解析的一方无法遮盖，此时不返回 diff
+	maskedLive, liveErr := maskConfigSecrets(live)
+	maskedCandidate, candidateErr := maskConfigSecrets(candidate)
+	if liveErr == nil && candidateErr == nil {
+		preview.Diff = UnifiedDiff(LiveConfigName, "candidate", maskedLive, maskedCandidate)
+	}
+
+	var liveTree, candidateTree map[string]interface{}
+	if yaml.Unmarshal(live, &liveTree) != nil || yaml.Unmarshal(candidate, &candidateTree) != nil {
+		// 无法比较字段时，只要内容有变化就认为需要重启
+		preview.RequiresRestart = preview.Changed
+		return preview
+	}
+	diffConfigTree(nil, liveTree, candidateTree, &preview.Changes)
+	sort.Slice(preview.Changes, func(i, j int) bool {
+		return preview.Changes[i].Path < preview.Changes[j].Path
+	})
+
+	// hysteria 不支持热加载，任何字段变化都需要重启；只修改注释或格式时不需要
+	preview.RequiresRestart = len(preview.Changes) > 0
+	return preview
+}
+
+// 递归比较两个配置树，映射逐个字段比较，列表作为整体比较
+func diffConfigTree(path []string, old, new map[string]interface{}, changes *[]ConfigChange) {
+	keys := make(map[string]bool, len(old)+len(new))
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+
+	for k := range keys {
+		childPath := append(append([]string{}, path...), k)
+		oldValue, inOld := old[k]
+		newValue, inNew := new[k]
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+
+		switch {
+		case oldIsMap && newIsMap:
+			diffConfigTree(childPath, oldMap, newMap, changes)
+		case !inOld && newIsMap:
+			diffConfigTree(childPath, nil, newMap, changes)
+		case !inNew && oldIsMap:
+			diffConfigTree(childPath, oldMap, nil, changes)
+		case !inOld:
+			*changes = append(*changes, ConfigChange{
+				Path: strings.Join(childPath, "."),
+				Type: ConfigChangeAdded,
+				New:  maskConfigValue(childPath, newValue),
+			})
+		case !inNew:
+			*changes = append(*changes, ConfigChange{
+				Path: strings.Join(childPath, "."),
+				Type: ConfigChangeRemoved,
+				Old:  maskConfigValue(childPath, oldValue),
+			})
+		case !reflect.DeepEqual(oldValue, newValue):
+			*changes = append(*changes, ConfigChange{
+				Path: strings.Join(childPath, "."),
+				Type: ConfigChangeChanged,
+				Old:  maskConfigValue(childPath, oldValue),
+				New:  maskConfigValue(childPath, newValue),
+			})
+		}
+	}
+}
+
+// 遮盖密钥字段，列表和映射中的密钥字段同样被遮盖
+func maskConfigValue(path []string, value interface{}) interface{} {
+	if isSecretConfigPath(path) {
+		return maskedSecret
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		masked := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			masked[k] = maskConfigValue(append(append([]string{}, path...), k), item)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskConfigValue(path, item)
+		}
+		return masked
+	}
+	return value
+}
+
+// 遮盖 YAML 文本中的密钥字段，保留注释、字段顺序和缩进
+func maskConfigSecrets(data []byte) ([]byte, error) {
+	doc, err := ParseConfigDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	maskSecretNodes(nil, doc.root)
+	return doc.Bytes()
+}
+
+// 遍历节点树，遮盖密钥路径下的所有标量，列表中的元素沿用列表的路径
+func maskSecretNodes(path []string, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childPath := append(append([]string{}, path...), node.Content[i].Value)
+			if isSecretConfigPath(childPath) {
+				maskNode(node.Content[i+1])
+			} else {
+				maskSecretNodes(childPath, node.Content[i+1])
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			maskSecretNodes(path, item)
+		}
+	}
+}
+
+// 把节点中的所有标量替换为遮盖后的字符串，映射的键保持不变
+func maskNode(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		node.Value = maskedSecret
+		node.Tag = "!!str"
+		node.Style = 0
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			maskNode(node.Content[i])
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			maskNode(item)
+		}
+	}
+}
+
+func isSecretConfigPath(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	key := strings.ToLower(path[len(path)-1])
+	for _, keyword := range secretConfigKeywords {
+		if strings.Contains(key, keyword) {
+			return true
+		}
+	}
+	switch {
+	// auth.userpass 下的值是用户密码
+	case len(path) == 3 && path[0] == "auth" && path[1] == "userpass":
+		return true
+	// acme.dns.config 下是 DNS 服务商的凭据，字段名因服务商而异，全部遮盖
+	case len(path) > 3 && path[0] == "acme" && path[1] == "dns" && path[2] == "config":
+		return true
+	}
+	return false
+}
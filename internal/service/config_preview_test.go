@@ -0,0 +1,203 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestIsSecretConfigPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"auth.password", true},
+		{"auth.userpass.alice", true},
+		{"auth.userpass", false},
+		{"auth.type", false},
+		{"auth.http.url", false},
+		{"obfs.salamander.password", true},
+		{"trafficStats.secret", true},
+		{"trafficStats.listen", false},
+		{"tls.key", true},
+		{"tls.cert", false},
+		{"acme.dns.config.cloudflare_api_token", true},
+		{"acme.dns.config.aws_region", true},
+		{"acme.dns.name", false},
+		{"acme.domains", false},
+		{"outbounds.socks5.password", true},
+		{"masquerade.proxy.url", false},
+		{"quic.maxIdleTimeout", false},
+		{"foo.secretAccessKey", true},
+		{"foo.apiKey", true},
+		{"foo.TOKEN", true},
+	}
+
+	for _, tt := range tests {
+		if got := isSecretConfigPath(strings.Split(tt.path, ".")); got != tt.want {
+			t.Errorf("isSecretConfigPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDiffConfigTreeMasksSecrets(t *testing.T) {
+	live := `
+listen: :443
+auth:
+  type: userpass
+  userpass:
+    alice: alice_old
+    bob: bob_password
+obfs:
+  type: salamander
+  salamander:
+    password: obfs_old
+acme:
+  domains: [example.com]
+  dns:
+    name: cloudflare
+    config:
+      cloudflare_api_token: token_old
+`
+	candidate := `
+listen: :8443
+auth:
+  type: userpass
+  userpass:
+    alice: alice_new
+    carol: carol_password
+obfs:
+  type: salamander
+  salamander:
+    password: obfs_new
+acme:
+  domains: [example.com]
+  dns:
+    name: cloudflare
+    config:
+      cloudflare_api_token: token_new
+      zone: example.com
+trafficStats:
+  listen: 127.0.0.1:18990
+  secret: stats_secret
+`
+	var oldTree, newTree map[string]interface{}
+	if err := yaml.Unmarshal([]byte(live), &oldTree); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(candidate), &newTree); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []ConfigChange
+	diffConfigTree(nil, oldTree, newTree, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	want := []ConfigChange{
+		{Path: "acme.dns.config.cloudflare_api_token", Type: ConfigChangeChanged, Old: maskedSecret, New: maskedSecret},
+		{Path: "acme.dns.config.zone", Type: ConfigChangeAdded, New: maskedSecret},
+		{Path: "auth.userpass.alice", Type: ConfigChangeChanged, Old: maskedSecret, New: maskedSecret},
+		{Path: "auth.userpass.bob", Type: ConfigChangeRemoved, Old: maskedSecret},
+		{Path: "auth.userpass.carol", Type: ConfigChangeAdded, New: maskedSecret},
+		{Path: "listen", Type: ConfigChangeChanged, Old: ":443", New: ":8443"},
+		{Path: "obfs.salamander.password", Type: ConfigChangeChanged, Old: maskedSecret, New: maskedSecret},
+		{Path: "trafficStats.listen", Type: ConfigChangeAdded, New: "127.0.0.1:18990"},
+		{Path: "trafficStats.secret", Type: ConfigChangeAdded, New: maskedSecret},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes =\n%+v\nwant:\n%+v", changes, want)
+	}
+}
+
+func TestMaskConfigValueInLists(t *testing.T) {
+	value := []interface{}{
+		map[string]interface{}{"name": "proxy", "type": "socks5", "socks5": map[string]interface{}{"addr": "1.2.3.4:1080", "password": "p"}},
+	}
+	want := []interface{}{
+		map[string]interface{}{"name": "proxy", "type": "socks5", "socks5": map[string]interface{}{"addr": "1.2.3.4:1080", "password": maskedSecret}},
+	}
+	if got := maskConfigValue([]string{"outbounds"}, value); !reflect.DeepEqual(got, want) {
+		t.Errorf("maskConfigValue() = %v, want %v", got, want)
+	}
+}
+
+func TestMaskConfigSecrets(t *testing.T) {
+	data := `# hysteria config
+listen: :443
+auth:
+  type: password
+  password: your_password # keep me
+obfs:
+  type: salamander
+  salamander:
+    password: obfs_password
+outbounds:
+  - name: proxy
+    type: socks5
+    socks5:
+      addr: 1.2.3.4:1080
+      password: socks_password
+acme:
+  dns:
+    name: cloudflare
+    config:
+      cloudflare_api_token: cf_token
+`
+	want := `# hysteria config
+listen: :443
+auth:
+  type: password
+  password: '******' # keep me
+obfs:
+  type: salamander
+  salamander:
+    password: '******'
+outbounds:
+  - name: proxy
+    type: socks5
+    socks5:
+      addr: 1.2.3.4:1080
+      password: '******'
+acme:
+  dns:
+    name: cloudflare
+    config:
+      cloudflare_api_token: '******'
+`
+	got, err := maskConfigSecrets([]byte(data))
+	if err != nil {
+		t.Fatalf("maskConfigSecrets() error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("maskConfigSecrets() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPreviewDiffHidesSecrets(t *testing.T) {
+	live := []byte("listen: :443\nauth:\n  type: userpass\n  userpass:\n    alice: alice_old\n")
+	candidate := []byte("listen: :8443\nauth:\n  type: userpass\n  userpass:\n    alice: alice_new\n    bob: bob_password\n")
+
+	maskedLive, err := maskConfigSecrets(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maskedCandidate, err := maskConfigSecrets(candidate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := UnifiedDiff(LiveConfigName, "candidate", maskedLive, maskedCandidate)
+
+	for _, secret := range []string{"alice_old", "alice_new", "bob_password"} {
+		if strings.Contains(diff, secret) {
+			t.Errorf("diff contains %q:\n%s", secret, diff)
+		}
+	}
+	// 只有密码变化的行不出现在 diff 中，新增用户和其他字段的变化仍然可见
+	want := "--- current\n+++ candidate\n@@ -1,5 +1,6 @@\n-listen: :443\n+listen: :8443\n auth:\n   type: userpass\n   userpass:\n     alice: '******'\n+    bob: '******'\n"
+	if diff != want {
+		t.Errorf("diff =\n%s\nwant:\n%s", diff, want)
+	}
+}
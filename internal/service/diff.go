@@ -0,0 +1,174 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 统一格式 diff 中每个变更块前后保留的上下文行数
+const diffContext = 3
+
+// 文件末尾没有换行时附加在最后一行之后，输出时恰好成为单独的一行标记
+const noNewlineMarker = "\n\\ No newline at end of file"
+
+type diffOp struct {
+	kind byte // ' '、'-' 或 '+'
+	line string
+	a, b int // 该行在两边的行号（从 0 开始），不存在的一边为 -1
+}
+
+// 按行生成统一格式（unified）的 diff，内容相同时返回空字符串
+func UnifiedDiff(fromName, toName string, from, to []byte) string {
+	a, b := splitLines(string(from)), splitLines(string(to))
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// 找到下一处变更
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// 向后合并间隔不超过两倍上下文的变更
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i
+			} else if i-end > 2*diffContext {
+				break
+			}
+		}
+
+		lo := max(start-diffContext, 0)
+		hi := min(end+diffContext+1, len(ops))
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, ops[lo:hi])
+		start = hi
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	aStart, bStart, aLen, bLen := -1, -1, 0, 0
+	for _, op := range ops {
+		if op.a >= 0 {
+			if aStart < 0 {
+				aStart = op.a
+			}
+			aLen++
+		}
+		if op.b >= 0 {
+			if bStart < 0 {
+				bStart = op.b
+			}
+			bLen++
+		}
+	}
+	// 一边没有行时，起始行号为变更位置之前的一行
+	if aStart < 0 {
+		aStart = hunkAnchor(ops, func(op diffOp) int { return op.a })
+	} else {
+		aStart++
+	}
+	if bStart < 0 {
+		bStart = hunkAnchor(ops, func(op diffOp) int { return op.b })
+	} else {
+		bStart++
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		out.WriteByte('\n')
+	}
+}
+
+// 没有行的一边的起始行号，由另一边的行推算
+func hunkAnchor(ops []diffOp, side func(diffOp) int) int {
+	for _, op := range ops {
+		if n := side(op); n >= 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func hunkRange(start, length int) string {
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// 按行拆分，末尾没有换行时最后一行带上 noNewlineMarker，
+// 因此只差末尾换行的两行被视为不同，与 GNU diff 的行为一致
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] += noNewlineMarker
+	}
+	return lines
+}
+
+// 基于最长公共子序列生成逐行的编辑序列，配置文件通常只有几百行，O(n*m) 足够
+func diffLines(a, b []string) []diffOp {
+	// 先去掉相同的首尾，缩小比较范围
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{' ', a[i], i, i})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i], prefix + i, prefix + j})
+			i++
+			j++
+		case j < len(mb) && (i == len(ma) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, diffOp{'+', mb[j], -1, prefix + j})
+			j++
+		default:
+			ops = append(ops, diffOp{'-', ma[i], prefix + i, -1})
+			i++
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		ops = append(ops, diffOp{' ', a[len(a)-suffix+k], len(a) - suffix + k, len(b) - suffix + k})
+	}
+	return ops
+}
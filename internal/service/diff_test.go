@@ -0,0 +1,124 @@
+package service
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{
+			name: "identical",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			from: "a\nb\nc\n",
+			to:   "a\nx\nc\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "insert into empty",
+			from: "",
+			to:   "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "delete everything",
+			from: "a\n",
+			to:   "",
+			want: "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name: "pure insertion keeps anchor",
+			from: "a\nb\n",
+			to:   "a\nx\nb\n",
+			want: "--- old\n+++ new\n@@ -1,2 +1,3 @@\n a\n+x\n b\n",
+		},
+		{
+			name: "separate hunks",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:   "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:   "x\n2\n3\n4\n5\n6\n7\ny\n",
+			want: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n",
+		},
+		{
+			name: "added trailing newline",
+			from: "a\nb",
+			to:   "a\nb\n",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "removed trailing newline",
+			from: "a\nb\n",
+			to:   "a\nb",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name: "context line without trailing newline",
+			from: "a\nb",
+			to:   "x\nb",
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-a\n+x\n b\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("old", "new", []byte(tt.from), []byte(tt.to))
+			if got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLCS(t *testing.T) {
+	a := []string{"a", "b", "c", "a", "b", "b", "a"}
+	b := []string{"c", "b", "a", "b", "a", "c"}
+
+	var kept, removed, added int
+	var gotA, gotB []string
+	for _, op := range diffLines(a, b) {
+		switch op.kind {
+		case ' ':
+			kept++
+			gotA = append(gotA, op.line)
+			gotB = append(gotB, op.line)
+		case '-':
+			removed++
+			gotA = append(gotA, op.line)
+		case '+':
+			added++
+			gotB = append(gotB, op.line)
+		}
+	}
+
+	// 最长公共子序列的长度为 4，编辑序列应当最短
+	if kept != 4 || removed != len(a)-4 || added != len(b)-4 {
+		t.Errorf("kept %d, removed %d, added %d; want 4, %d, %d", kept, removed, added, len(a)-4, len(b)-4)
+	}
+	// 编辑序列必须能还原两边的内容
+	if !equalLines(gotA, a) || !equalLines(gotB, b) {
+		t.Errorf("edit script does not reproduce inputs: %v / %v", gotA, gotB)
+	}
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const DefaultEnforceInterval = time.Minute
+
+// 配额和过期检查，仅在使用内置 HTTP 认证时生效
+// 超出配额或过期的用户会被禁用并踢下线，到达重置日或配额、有效期被调整后自动恢复
+type QuotaEnforcer struct {
+	userService    *UserService
+	trafficService *TrafficService
+}
+
+func NewQuotaEnforcer(userService *UserService, trafficService *TrafficService) *QuotaEnforcer {
+	return &QuotaEnforcer{
+		userService:    userService,
+		trafficService: trafficService,
+	}
+}
+
+// 定时执行检查
+func (e *QuotaEnforcer) Run(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultEnforceInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// 后台检查等待操作锁，最多等待一个检查周期，避免与 API 请求争抢时让请求返回 409
+	ctx := WithOperationWait(context.Background(), interval)
+	for range ticker.C {
+		_, err := e.Enforce(ctx)
+		switch {
+		case errors.Is(err, ErrOperationInProgress):
+			log.Printf("其他操作正在执行，跳过本次配额检查: %v", err)
+		case err != nil && !errors.Is(err, ErrAuthNotManaged):
+			log.Printf("配额检查失败: %v", err)
+		}
+	}
+}
+
+// 执行一次检查，返回被踢下线的用户
+// 只在修改用户和踢出用户时持有操作锁，等待时间由 ctx 指定，锁被占用时返回 OperationBusyError
+func (e *QuotaEnforcer) Enforce(ctx context.Context) ([]string, error) {
+	if mode, err := e.userService.authMode(); err != nil {
+		return nil, err
+	} else if mode != AuthModeHTTP {
+		return nil, ErrAuthNotManaged
+	}
+
+	// 先采集一次流量，保证用量是最新的，采集不修改任何状态，不需要持有锁
+	if err := e.trafficService.Poll(); err != nil && !errors.Is(err, ErrTrafficStatsDisabled) {
+		return nil, err
+	}
+
+	lease, ctx, err := BeginOperation(ctx, "enforce_quota")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	now := time.Now()
+	var kicked, reset []string
+	err = e.userService.authServer.Store().Update(func(users map[string]*HysteriaUser) error {
+		for name, user := range users {
+			// 到达重置日时清零流量
+			if user.ResetDay > 0 {
+				boundary := lastResetTime(now, user.ResetDay)
+				if user.LastReset == nil {
+					user.LastReset = &now
+				} else if user.LastReset.Before(boundary) {
+					user.LastReset = &now
+					reset = append(reset, name)
+				}
+			}
+
+			used := uint64(0)
+			if !contains(reset, name) {
+				traffic := e.trafficService.GetUserTraffic(name)
+				used = traffic.Tx + traffic.Rx
+			}
+			expired := user.ExpiresAt != nil && !now.Before(*user.ExpiresAt)
+			overQuota := user.QuotaBytes > 0 && used >= user.QuotaBytes
+
+			switch {
+			case user.Enabled && expired:
+				user.Enabled = false
+				user.DisabledReason = UserStatusExpired
+				kicked = append(kicked, name)
+			case user.Enabled && overQuota:
+				user.Enabled = false
+				user.DisabledReason = UserStatusQuotaExceeded
+				kicked = append(kicked, name)
+			case !user.Enabled && user.DisabledReason == UserStatusExpired && !expired && !overQuota,
+				!user.Enabled && user.DisabledReason == UserStatusQuotaExceeded && !expired && !overQuota:
+				// 重置、续期或调整配额后恢复
+				user.Enabled = true
+				user.DisabledReason = ""
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range reset {
+		if err := e.trafficService.ResetUser(name); err != nil {
+			log.Printf("重置用户 %s 的流量失败: %v", name, err)
+		}
+	}
+
+	if len(kicked) > 0 {
+		if err := e.trafficService.Kick(ctx, kicked); err != nil && !errors.Is(err, ErrTrafficStatsDisabled) {
+			return kicked, err
+		}
+		log.Printf("已禁用并踢出用户: %v", kicked)
+	}
+	return kicked, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
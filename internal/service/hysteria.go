@@ -1,31 +1,48 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 )
 
-type Hysteria2Service struct{}
+type Hysteria2Service struct {
+	units ServiceManager
+}
 
 type Hysteria2Status struct {
-	IsInstalled   bool   `json:"is_installed"`
-	IsRunning     bool   `json:"is_running"`
-	Version       string `json:"version"`
-	BuildDate     string `json:"build_date,omitempty"`
-	BuildType     string `json:"build_type,omitempty"`
-	Platform      string `json:"platform,omitempty"`
-	Architecture  string `json:"architecture,omitempty"`
-	ServiceStatus string `json:"service_status,omitempty"` // 服务状态描述
-	LastError     string `json:"last_error,omitempty"`     // 最后一次错误信息
-	LoadState     string `json:"load_state,omitempty"`     // 加载状态
-	ActiveState   string `json:"active_state,omitempty"`   // 活动状态
+	IsInstalled    bool       `json:"is_installed"`
+	IsRunning      bool       `json:"is_running"`
+	Version        string     `json:"version"`
+	BuildDate      string     `json:"build_date,omitempty"`
+	BuildType      string     `json:"build_type,omitempty"`
+	Platform       string     `json:"platform,omitempty"`
+	Architecture   string     `json:"architecture,omitempty"`
+	ServiceStatus  string     `json:"service_status,omitempty"` // 服务状态描述：running, stopped, failed 或过渡状态
+	LastError      string     `json:"last_error,omitempty"`     // 最后一次运行失败的原因
+	LoadState      string     `json:"load_state,omitempty"`     // 加载状态
+	ActiveState    string     `json:"active_state,omitempty"`   // 活动状态
+	SubState       string     `json:"sub_state,omitempty"`      // 子状态
+	Result         string     `json:"result,omitempty"`         // 最后一次运行的结果
+	MainPID        uint32     `json:"main_pid,omitempty"`       // 主进程 PID
+	ExecMainStatus int32      `json:"exec_main_status"`         // 主进程最后一次退出的状态码
+	ActiveSince    *time.Time `json:"active_since,omitempty"`   // 最近一次启动的时间
+	NRestarts      uint32     `json:"n_restarts"`               // 自动重启次数
+
+	// 进程资源占用，服务未运行时为空
+	MemoryUsage uint64          `json:"memory_usage,omitempty"` // 常驻内存，字节
+	CPUUsage    float64         `json:"cpu_usage"`              // CPU 占用率
+	Uptime      string          `json:"uptime,omitempty"`       // 进程运行时间，如 "2d 5h 30m"
+	Process     *ProcessMetrics `json:"process,omitempty"`
+
+	Certificates []CertificateInfo `json:"certificates,omitempty"` // hysteria 和 agent 使用的证书
 }
 
 // 获取日志的选项
@@ -37,13 +54,27 @@ type LogOptions struct {
 
 // 健康检查结果
 type HealthCheck struct {
-	IsRunning   bool   `json:"is_running"`
-	PortOpen    bool   `json:"port_open"`
-	ConfigValid bool   `json:"config_valid"`
-	LastError   string `json:"last_error,omitempty"`
-	CheckTime   string `json:"check_time"`
+	Status       string             `json:"status"`            // ok, warning 或 fail
+	Reasons      []string           `json:"reasons,omitempty"` // status 不为 ok 的原因
+	IsRunning    bool               `json:"is_running"`
+	PortOpen     bool               `json:"port_open"` // 监听端口是否由 hysteria 持有
+	Listener     *ListenerCheck     `json:"listener,omitempty"`
+	ConfigValid  bool               `json:"config_valid"`
+	ConfigErrors []ConfigFinding    `json:"config_errors,omitempty"`
+	PortHopping  *PortHoppingStatus `json:"port_hopping,omitempty"` // 仅在启用端口跳跃时返回
+	Probe        *ProbeResult       `json:"probe,omitempty"`        // 最近一次端到端探测的结果
+	Certificates []CertificateInfo  `json:"certificates,omitempty"`
+	LastError    string             `json:"last_error,omitempty"`
+	CheckTime    string             `json:"check_time"`
 }
 
+// 健康检查的总体状态
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusWarning = "warning"
+	HealthStatusFail    = "fail"
+)
+
 // 定义常见错误
 var (
 	ErrServiceNotRunning = fmt.Errorf("service is not running")
@@ -52,7 +83,7 @@ var (
 )
 
 func NewHysteria2Service() *Hysteria2Service {
-	return &Hysteria2Service{}
+	return &Hysteria2Service{units: defaultServiceManager}
 }
 
 // 检查是否已安装
@@ -84,44 +115,37 @@ func (h *Hysteria2Service) GetVersion() string {
 	return ""
 }
 
-// 获取服务详细状态
-func (h *Hysteria2Service) getServiceStatus() (string, string, string, string) {
-	cmd := exec.Command("systemctl", "status", "hysteria-server.service")
-	output, _ := cmd.CombinedOutput()
-	outputStr := string(output)
+// 读取 hysteria-server 的单元状态
+func (h *Hysteria2Service) unitStatus() (*UnitStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), unitJobTimeout)
+	defer cancel()
+	return h.units.Status(ctx, hysteriaUnitName)
+}
 
-	// 解析状态输出
-	var serviceStatus, lastError, loadState, activeState string
+// 单元状态的简要描述，过渡状态（activating 等）原样返回
+func serviceStatusOf(unit *UnitStatus) string {
+	switch {
+	case unit.Running():
+		return "running"
+	case unit.ActiveState == "failed":
+		return "failed"
+	case unit.ActiveState == "inactive":
+		return "stopped"
+	}
+	return unit.ActiveState
+}
 
-	lines := strings.Split(outputStr, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		switch {
-		case strings.Contains(line, "Loaded:"):
-			if strings.Contains(line, "loaded") {
-				loadState = "loaded"
-			} else {
-				loadState = "not-loaded"
-			}
-		case strings.Contains(line, "Active:"):
-			if strings.Contains(line, "active (running)") {
-				activeState = "active"
-				serviceStatus = "running"
-			} else if strings.Contains(line, "failed") {
-				activeState = "failed"
-				serviceStatus = "failed"
-			} else if strings.Contains(line, "inactive") {
-				activeState = "inactive"
-				serviceStatus = "stopped"
-			}
-		case strings.Contains(line, "FATAL") || strings.Contains(line, "ERROR") || strings.Contains(line, "Failed"):
-			if lastError == "" { // 只获取第一个错误
-				lastError = strings.TrimSpace(strings.Join(strings.Split(line, ":")[2:], ":"))
-			}
+// 最后一次运行失败的原因，优先取本次运行期间日志中的错误，否则使用单元的运行结果
+func (h *Hysteria2Service) unitLastError(unit *UnitStatus) string {
+	if unit.Result == "" || unit.Result == "success" {
+		return ""
+	}
+	if unit.ActiveSince != nil {
+		if journalErr := h.lastJournalError(*unit.ActiveSince); journalErr != "" {
+			return journalErr
 		}
 	}
-
-	return serviceStatus, lastError, loadState, activeState
+	return fmt.Sprintf("%s, exit status %d", unit.Result, unit.ExecMainStatus)
 }
 
 // 获取运行状态
@@ -159,107 +183,95 @@ func (h *Hysteria2Service) GetStatus() (*Hysteria2Status, error) {
 		}
 
 		// 获取服务详细状态
-		serviceStatus, lastError, loadState, activeState := h.getServiceStatus()
-		status.ServiceStatus = serviceStatus
-		status.LastError = lastError
-		status.LoadState = loadState
-		status.ActiveState = activeState
-		status.IsRunning = activeState == "active"
+		unit, err := h.unitStatus()
+		if unit != nil {
+			status.ServiceStatus = serviceStatusOf(unit)
+			status.LoadState = unit.LoadState
+			status.ActiveState = unit.ActiveState
+			status.SubState = unit.SubState
+			status.Result = unit.Result
+			status.MainPID = unit.MainPID
+			status.ExecMainStatus = unit.ExecMainStatus
+			status.ActiveSince = unit.ActiveSince
+			status.NRestarts = unit.NRestarts
+			status.IsRunning = unit.Running()
+			status.LastError = h.unitLastError(unit)
+		}
+		if unit != nil && unit.MainPID != 0 {
+			if metrics, err := sampleProcess(int32(unit.MainPID)); err == nil {
+				metrics.Restarts = unit.NRestarts
+				status.Process = metrics
+				status.MemoryUsage = metrics.RSS
+				status.CPUUsage = metrics.CPUPercent
+				status.Uptime = formatUptime(time.Since(metrics.StartTime))
+			}
+		}
+		if err != nil {
+			status.LastError = err.Error()
+		}
 	}
 
 	return status, nil
 }
 
-// 安装Hysteria2
-func (h *Hysteria2Service) Install() (string, error) {
-	// 安装命令
-	installCmd := exec.Command("bash", "-c", "curl -fsSL https://get.hy2.sh/ | bash")
-	output, err := installCmd.CombinedOutput()
+// 卸载Hysteria2：停止服务、取消开机自启，删除单元文件和二进制文件，输出实时写入 out
+func (h *Hysteria2Service) Uninstall(ctx context.Context, out io.Writer) error {
+	lease, ctx, err := BeginOperation(ctx, "uninstall")
 	if err != nil {
-		return string(output), err
+		return err
 	}
+	defer lease.Release()
 
-	// 设置开机自启
-	enableCmd := exec.Command("systemctl", "enable", "hysteria-server.service")
-	if err := enableCmd.Run(); err != nil {
-		return string(output), err
-	}
+	ctx, cancel := context.WithTimeout(ctx, unitJobTimeout)
+	defer cancel()
 
-	return string(output), nil
-}
+	// 先停止服务并取消开机自启，单元不存在时跳过
+	if _, err := h.units.Status(ctx, hysteriaUnitName); err == nil {
+		fmt.Fprintf(out, "Stopping %s\n", hysteriaUnitName)
+		if err := h.units.Stop(ctx, hysteriaUnitName); err != nil {
+			return fmt.Errorf("failed to stop service: %w", err)
+		}
+		fmt.Fprintf(out, "Disabling %s\n", hysteriaUnitName)
+		if err := h.units.Disable(ctx, hysteriaUnitName); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, ErrUnitNotFound) {
+		return err
+	}
 
-// 卸载Hysteria2
-func (h *Hysteria2Service) Uninstall() (string, error) {
-	cmd := exec.Command("bash", "-c", "curl -fsSL https://get.hy2.sh/ | bash -s -- --remove")
-	output, err := cmd.CombinedOutput()
-	return string(output), err
-}
+	// 删除单元文件和二进制文件，配置文件和证书保留
+	for _, path := range []string{hysteriaUnitPath, hysteriaBinaryPath} {
+		fmt.Fprintf(out, "Removing %s\n", path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+	}
 
-// 更新Hysteria2
-func (h *Hysteria2Service) Update() (string, error) {
-	cmd := exec.Command("bash", "-c", "curl -fsSL https://get.hy2.sh/ | bash")
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	fmt.Fprintln(out, "Reloading systemd")
+	if err := h.units.Reload(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Hysteria2 has been removed, config in %s is kept\n", filepath.Dir(hysteriaConfigPath))
+	return nil
 }
 
 // 获取配置
 func (h *Hysteria2Service) GetConfig() (string, error) {
-	data, err := os.ReadFile("/etc/hysteria/config.yaml")
+	data, err := os.ReadFile(hysteriaConfigPath)
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
 
-// 备份配置
-func (h *Hysteria2Service) BackupConfig() (string, error) {
-	// 限制备份文件数量
-	const maxBackups = 5
-
-	// 读取当前配置
-	data, err := os.ReadFile("/etc/hysteria/config.yaml")
-	if err != nil {
-		return "", err
-	}
-
-	// 生成备份文件名（带时间戳）
-	backupPath := fmt.Sprintf("/etc/hysteria/config.yaml.bak.%s",
-		time.Now().Format("20060102150405"))
-
-	// 写入备份文件
-	if err := os.WriteFile(backupPath, data, 0644); err != nil {
-		return "", err
-	}
-
-	// 清理旧备份
-	backups, _ := h.GetConfigBackups()
-	if len(backups) > maxBackups {
-		for _, backup := range backups[maxBackups:] {
-			os.Remove(filepath.Join("/etc/hysteria", backup))
-		}
-	}
-
-	return backupPath, nil
-}
-
-// 修改配置时自动备份
-func (h *Hysteria2Service) UpdateConfig(config string) error {
-	// 先备份当前配置
-	if _, err := h.BackupConfig(); err != nil {
-		return fmt.Errorf("failed to backup config: %v", err)
-	}
-
-	// 写入新配置
-	if err := ioutil.WriteFile("/etc/hysteria/config.yaml", []byte(config), 0644); err != nil {
-		return err
-	}
-
-	return h.Restart()
+// 修改配置时自动备份，重启失败时自动回滚
+func (h *Hysteria2Service) UpdateConfig(ctx context.Context, config string) (*ConfigApplyResult, error) {
+	return h.applyConfig(ctx, []byte(config))
 }
 
 // 获取日志
 func (h *Hysteria2Service) GetLogs(opts *LogOptions) (string, error) {
-	args := []string{"--no-pager", "-u", "hysteria-server.service"}
+	args := []string{"--no-pager", "-u", hysteriaUnitName}
 
 	if opts != nil {
 		if opts.Lines > 0 {
@@ -298,91 +310,89 @@ func (h *Hysteria2Service) GetLogs(opts *LogOptions) (string, error) {
 	return string(output), nil
 }
 
-// 启动服务
-func (h *Hysteria2Service) Start() error {
-	const maxRetries = 3
-	const retryDelay = time.Second
-
-	// 执行启动命令
-	cmd := exec.Command("systemctl", "start", "hysteria-server.service")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to start service")
+// 启动服务，启动任务完成后确认服务处于运行状态
+func (h *Hysteria2Service) Start(ctx context.Context) error {
+	lease, ctx, err := BeginOperation(ctx, "start")
+	if err != nil {
+		return err
 	}
+	defer lease.Release()
 
-	// 重试检查服务状态
-	for i := 0; i < maxRetries; i++ {
-		time.Sleep(retryDelay)
-		status, _ := h.GetStatus()
-		if status != nil && status.ServiceStatus == "running" {
-			return nil
-		}
+	ctx, cancel := context.WithTimeout(ctx, unitJobTimeout)
+	defer cancel()
+	if err := h.units.Start(ctx, hysteriaUnitName); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
 	}
-
-	// 获取详细状态
-	status, _ := h.GetStatus()
-	if status != nil {
-		if status.ServiceStatus != "running" {
-			if status.LastError != "" {
-				return fmt.Errorf("failed to start service: %s", status.LastError)
-			}
-			return fmt.Errorf("failed to start service: service is in %s state", status.ServiceStatus)
-		}
-	}
-
-	return nil
+	return h.checkRunning("start")
 }
 
 // 停止服务
-func (h *Hysteria2Service) Stop() error {
-	// 执行停止命令
-	cmd := exec.Command("systemctl", "stop", "hysteria-server.service")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to stop service")
+func (h *Hysteria2Service) Stop(ctx context.Context) error {
+	lease, ctx, err := BeginOperation(ctx, "stop")
+	if err != nil {
+		return err
 	}
+	defer lease.Release()
 
-	// 等待一小段时间让服务状态更新
-	time.Sleep(time.Second)
-
-	// 只检查是否已停止
-	cmd = exec.Command("systemctl", "is-active", "hysteria-server.service")
-	output, _ := cmd.Output()
-	status := strings.TrimSpace(string(output))
+	ctx, cancel := context.WithTimeout(ctx, unitJobTimeout)
+	defer cancel()
+	if err := h.units.Stop(ctx, hysteriaUnitName); err != nil {
+		return fmt.Errorf("failed to stop service: %w", err)
+	}
 
-	switch status {
+	unit, err := h.unitStatus()
+	if err != nil {
+		return err
+	}
+	switch unit.ActiveState {
 	case "inactive":
 		return nil
 	case "failed":
-		return fmt.Errorf("service is in failed state")
-	case "unknown":
-		return fmt.Errorf("service state is unknown")
+		return ErrServiceFailed
 	default:
-		return fmt.Errorf("failed to stop service: current state is %s", status)
+		return fmt.Errorf("failed to stop service: current state is %s", unit.ActiveState)
 	}
 }
 
-// 重启服务
-func (h *Hysteria2Service) Restart() error {
-	// 执行重启命令
-	cmd := exec.Command("systemctl", "restart", "hysteria-server.service")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to restart service")
+// 重启服务，重启任务完成后确认服务处于运行状态
+func (h *Hysteria2Service) Restart(ctx context.Context) error {
+	lease, ctx, err := BeginOperation(ctx, "restart")
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	ctx, cancel := context.WithTimeout(ctx, unitJobTimeout)
+	defer cancel()
+	if err := h.units.Restart(ctx, hysteriaUnitName); err != nil {
+		return fmt.Errorf("failed to restart service: %w", err)
 	}
+	return h.checkRunning("restart")
+}
 
-	// 等待一小段时间让服务状态更新
-	time.Sleep(time.Second)
+// simple 类型的服务在进程创建后任务即完成，短暂等待以发现启动后立即退出的情况
+func (h *Hysteria2Service) checkRunning(action string) error {
+	const maxRetries = 3
+	const retryDelay = time.Second
 
-	// 获取详细状态
-	status, _ := h.GetStatus()
-	if status != nil {
-		if status.ServiceStatus != "running" {
-			if status.LastError != "" {
-				return fmt.Errorf("failed to restart service: %s", status.LastError)
-			}
-			return fmt.Errorf("failed to restart service: service is in %s state", status.ServiceStatus)
+	var unit *UnitStatus
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		time.Sleep(retryDelay)
+		if unit, err = h.unitStatus(); err != nil {
+			return err
+		}
+		if unit.Running() {
+			return nil
+		}
+		if unit.ActiveState == "failed" || unit.ActiveState == "inactive" {
+			break
 		}
 	}
-
-	return nil
+	if lastError := h.unitLastError(unit); lastError != "" {
+		return fmt.Errorf("failed to %s service: %s", action, lastError)
+	}
+	return fmt.Errorf("failed to %s service: service is in %s state", action, serviceStatusOf(unit))
 }
 
 // 执行健康检查
@@ -399,41 +409,74 @@ func (h *Hysteria2Service) CheckHealth() (*HealthCheck, error) {
 	}
 
 	// 检查配置文件是否有效
-	if _, err := h.GetConfig(); err == nil {
-		health.ConfigValid = true
+	if config, err := h.GetConfig(); err == nil {
+		validation := h.ValidateConfig(config)
+		health.ConfigValid = validation.Valid
+		health.ConfigErrors = validation.Errors
 	}
 
-	// 检查端口是否开放
-	if config, err := h.GetConfig(); err == nil {
-		// 解析配置获取端口
-		port := h.getPortFromConfig(config)
-		if port != "" {
-			health.PortOpen = h.checkPortOpen(port)
-		}
+	// 检查监听端口是否由 hysteria 持有
+	if cfg, err := h.GetParsedConfig(); err == nil {
+		health.Listener = h.CheckListener(cfg.Listen)
+		health.PortOpen = health.Listener.State == PortBoundByHysteria
+	}
+
+	// 检查端口跳跃规则是否仍然存在
+	if hopping, err := NewPortHoppingService().GetStatus(); err == nil && hopping.Enabled {
+		health.PortHopping = hopping
+	}
+
+	health.Probe = LastProbeResult()
+
+	// 服务未运行、端口未监听、配置无效或端口跳跃规则丢失时失败，最近一次探测失败时提醒
+	health.Status = HealthStatusOK
+	if !health.IsRunning {
+		health.fail("service is not running")
+	}
+	if !health.PortOpen {
+		health.fail("listen port is not bound by hysteria")
+	}
+	if !health.ConfigValid {
+		health.fail("config is invalid")
+	}
+	if health.PortHopping != nil && !health.PortHopping.RulesPresent {
+		health.fail("port hopping is enabled but the forwarding rules are missing")
+	}
+	if health.Probe != nil && !health.Probe.Success {
+		health.warn(fmt.Sprintf("last probe failed at stage %s: %s", health.Probe.Stage, health.Probe.Error))
 	}
 
 	return health, nil
 }
 
-// 从配置中获取端口
-func (h *Hysteria2Service) getPortFromConfig(config string) string {
-	// 简单解析 YAML 配置中的 listen 字段
-	for _, line := range strings.Split(config, "\n") {
-		if strings.HasPrefix(strings.TrimSpace(line), "listen:") {
-			// 提取端口号
-			parts := strings.Split(line, ":")
-			if len(parts) >= 3 {
-				return parts[2]
-			}
-		}
+func (health *HealthCheck) fail(reason string) {
+	health.Status = HealthStatusFail
+	health.Reasons = append(health.Reasons, reason)
+}
+
+// 提醒不会覆盖失败状态
+func (health *HealthCheck) warn(reason string) {
+	if health.Status == HealthStatusOK {
+		health.Status = HealthStatusWarning
 	}
-	return ""
+	health.Reasons = append(health.Reasons, reason)
 }
 
-// 检查端口是否开放
-func (h *Hysteria2Service) checkPortOpen(port string) bool {
-	cmd := exec.Command("ss", "-ln", "|", "grep", port)
-	return cmd.Run() == nil
+// 加入证书检查结果，证书即将到期时提醒，已过期、私钥不匹配或无法读取时失败
+func (health *HealthCheck) AddCertificates(certs []CertificateInfo) {
+	health.Certificates = append(health.Certificates, certs...)
+	for _, cert := range certs {
+		name := cert.Path
+		if cert.Domain != "" {
+			name = cert.Domain
+		}
+		switch {
+		case cert.Failed():
+			health.fail(fmt.Sprintf("%s certificate %s: %s", cert.Source, name, cert.Error))
+		case cert.Status == CertStatusWarning:
+			health.warn(fmt.Sprintf("%s certificate %s: %s", cert.Source, name, cert.Error))
+		}
+	}
 }
 
 // 获取可用版本列表
@@ -482,66 +525,3 @@ func (h *Hysteria2Service) GetAvailableVersions() ([]string, error) {
 
 	return versions, nil
 }
-
-// 安装指定版本
-func (h *Hysteria2Service) InstallVersion(version string) error {
-	cmd := exec.Command("bash", "-c", fmt.Sprintf("curl -fsSL https://get.hy2.sh/ | bash -s -- --version %s", version))
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to install version %s: %v", version, err)
-	}
-	return nil
-}
-
-// 获取配置备份列表
-func (h *Hysteria2Service) GetConfigBackups() ([]string, error) {
-	// 读取/etc/hysteria目录下的所有备份文件
-	files, err := os.ReadDir("/etc/hysteria")
-	if err != nil {
-		return nil, err
-	}
-
-	// 筛选出备份文件
-	backups := make([]string, 0)
-	for _, file := range files {
-		if strings.HasPrefix(file.Name(), "config.yaml.bak.") {
-			backups = append(backups, file.Name())
-		}
-	}
-
-	// 按时间倒序排序（最新的在前）
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i] > backups[j]
-	})
-
-	return backups, nil
-}
-
-// 恢复配置备份
-func (h *Hysteria2Service) RestoreConfig(backup string) error {
-	// 安全检查：确保文件名是备份文件
-	if !strings.HasPrefix(backup, "config.yaml.bak.") {
-		return fmt.Errorf("invalid backup file name")
-	}
-
-	backupPath := filepath.Join("/etc/hysteria", backup)
-	configPath := "/etc/hysteria/config.yaml"
-
-	// 检查备份文件是否存在
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		return fmt.Errorf("backup file not found: %s", backup)
-	}
-
-	// 读取备份文件
-	data, err := os.ReadFile(backupPath)
-	if err != nil {
-		return fmt.Errorf("failed to read backup file: %v", err)
-	}
-
-	// 写入配置文件
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to restore config: %v", err)
-	}
-
-	// 重启服务以应用新配置
-	return h.Restart()
-}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// 重启后观察服务状态的时间窗口
+	applySettleWindow   = 5 * time.Second
+	applySettleInterval = 500 * time.Millisecond
+)
+
+// 配置应用结果
+type ConfigApplyResult struct {
+	BackupFile     string `json:"backup_file,omitempty"`     // 应用前创建的备份
+	RolledBack     bool   `json:"rolled_back"`               // 是否发生了回滚
+	RestoredBackup string `json:"restored_backup,omitempty"` // 回滚时恢复的备份
+}
+
+// 配置应用失败时返回的结构化错误
+type ConfigApplyError struct {
+	Reason         string `json:"reason"`                    // 从日志中获取的失败原因
+	BackupFile     string `json:"backup_file,omitempty"`     // 应用前创建的备份
+	RolledBack     bool   `json:"rolled_back"`               // 是否已回滚
+	RestoredBackup string `json:"restored_backup,omitempty"` // 回滚时恢复的备份
+	RollbackError  string `json:"rollback_error,omitempty"`  // 回滚本身失败的原因
+}
+
+func (e *ConfigApplyError) Error() string {
+	msg := fmt.Sprintf("failed to apply config: %s", e.Reason)
+	if e.RolledBack {
+		msg += fmt.Sprintf(" (rolled back to %s)", e.RestoredBackup)
+	} else if e.RollbackError != "" {
+		msg += fmt.Sprintf(" (rollback failed: %s)", e.RollbackError)
+	}
+	return msg
+}
+
+// 以事务方式应用配置：备份、写入、重启并观察，失败时自动恢复备份
+func (h *Hysteria2Service) applyConfig(ctx context.Context, data []byte) (*ConfigApplyResult, error) {
+	return h.applyConfigKeeping(ctx, data, "")
+}
+
+// 与 applyConfig 相同，keep 指定的备份不会被应用前备份触发的清理删除
+func (h *Hysteria2Service) applyConfigKeeping(ctx context.Context, data []byte, keep string) (*ConfigApplyResult, error) {
+	lease, ctx, err := BeginOperation(ctx, "apply_config")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	// 先备份当前配置
+	backupPath, err := h.backupConfig(keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to backup config: %v", err)
+	}
+	result := &ConfigApplyResult{BackupFile: filepath.Base(backupPath)}
+
+	// 写入新配置
+	if err := os.WriteFile(hysteriaConfigPath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	since := time.Now()
+	reason := h.restartAndSettle()
+	if reason == "" {
+		// 监听端口可能已变化，同步端口跳跃规则
+		if err := NewPortHoppingService().Restore(ctx); err != nil {
+			log.Printf("同步端口跳跃规则失败: %v", err)
+		}
+		return result, nil
+	}
+
+	// 新配置无法启动，恢复备份
+	applyErr := &ConfigApplyError{
+		Reason:     reason,
+		BackupFile: result.BackupFile,
+	}
+	if journalErr := h.lastJournalError(since); journalErr != "" {
+		applyErr.Reason = journalErr
+	}
+
+	backupData, err := os.ReadFile(backupPath)
+	if err != nil {
+		applyErr.RollbackError = fmt.Sprintf("failed to read backup: %v", err)
+		return nil, applyErr
+	}
+	if err := os.WriteFile(hysteriaConfigPath, backupData, 0644); err != nil {
+		applyErr.RollbackError = fmt.Sprintf("failed to restore backup: %v", err)
+		return nil, applyErr
+	}
+	if rollbackReason := h.restartAndSettle(); rollbackReason != "" {
+		applyErr.RollbackError = fmt.Sprintf("service did not recover after rollback: %s", rollbackReason)
+		return nil, applyErr
+	}
+
+	applyErr.RolledBack = true
+	applyErr.RestoredBackup = result.BackupFile
+	return nil, applyErr
+}
+
+// 重启服务并在观察窗口内等待其稳定运行，随后确认监听端口正常，返回空字符串表示成功，否则返回失败原因
+func (h *Hysteria2Service) restartAndSettle() string {
+	ctx, cancel := context.WithTimeout(context.Background(), unitJobTimeout)
+	defer cancel()
+	if err := h.units.Restart(ctx, hysteriaUnitName); err != nil {
+		return err.Error()
+	}
+
+	var unit *UnitStatus
+	deadline := time.Now().Add(applySettleWindow)
+	for time.Now().Before(deadline) {
+		time.Sleep(applySettleInterval)
+		current, err := h.unitStatus()
+		if err != nil {
+			return err.Error()
+		}
+		unit = current
+		if unit.ActiveState == "failed" {
+			break
+		}
+	}
+
+	if unit == nil {
+		return "service state is unknown"
+	}
+	if unit.Running() {
+		return h.settledHealth()
+	}
+	if lastError := h.unitLastError(unit); lastError != "" {
+		return lastError
+	}
+	return fmt.Sprintf("service is in %s state", serviceStatusOf(unit))
+}
+
+// 服务处于运行状态后，再按健康检查确认监听端口已由 hysteria 持有
+// 进程可能仍在运行但无法绑定端口，或端口被其他进程占用，这些情况同样需要回滚
+func (h *Hysteria2Service) settledHealth() string {
+	health, err := h.CheckHealth()
+	if err != nil {
+		return err.Error()
+	}
+	if !health.IsRunning {
+		return "service is not running"
+	}
+	if health.PortOpen {
+		return ""
+	}
+	listener := health.Listener
+	switch {
+	case listener == nil:
+		return "listen port is not bound by hysteria"
+	case listener.Error != "":
+		return fmt.Sprintf("failed to check listen port: %s", listener.Error)
+	case listener.State == PortBoundByOther:
+		return fmt.Sprintf("port %d is bound by another process", listener.Port)
+	}
+	return fmt.Sprintf("hysteria is running but port %d is not bound", listener.Port)
+}
+
+// 从日志中获取指定时间之后的最后一条错误
+func (h *Hysteria2Service) lastJournalError(since time.Time) string {
+	cmd := exec.Command("journalctl", "--no-pager", "-o", "cat",
+		"-u", hysteriaUnitName,
+		"--since", since.Format("2006-01-02 15:04:05"))
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+
+	var lastError string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "FATAL") || strings.Contains(line, "ERROR") {
+			lastError = line
+		}
+	}
+	return lastError
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	hysteriaConfigDir  = "/etc/hysteria"
+	hysteriaConfigPath = "/etc/hysteria/config.yaml"
+)
+
+// Hysteria2 服务端配置，仅用于读取和校验，修改通过 ConfigDocument 在节点树上进行
+// 未建模的字段保存在 Extra 中
+type Hysteria2Config struct {
+	Listen       string              `yaml:"listen,omitempty" json:"listen,omitempty"`
+	TLS          *TLSConfig          `yaml:"tls,omitempty" json:"tls,omitempty"`
+	ACME         *ACMEConfig         `yaml:"acme,omitempty" json:"acme,omitempty"`
+	Obfs         *ObfsConfig         `yaml:"obfs,omitempty" json:"obfs,omitempty"`
+	QUIC         *QUICConfig         `yaml:"quic,omitempty" json:"quic,omitempty"`
+	Bandwidth    *BandwidthConfig    `yaml:"bandwidth,omitempty" json:"bandwidth,omitempty"`
+	Auth         *AuthConfig         `yaml:"auth,omitempty" json:"auth,omitempty"`
+	ACL          *ACLConfig          `yaml:"acl,omitempty" json:"acl,omitempty"`
+	Outbounds    []OutboundConfig    `yaml:"outbounds,omitempty" json:"outbounds,omitempty"`
+	TrafficStats *TrafficStatsConfig `yaml:"trafficStats,omitempty" json:"trafficStats,omitempty"`
+	Masquerade   *MasqueradeConfig   `yaml:"masquerade,omitempty" json:"masquerade,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline" json:"-"`
+}
+
+type TLSConfig struct {
+	Cert     string `yaml:"cert,omitempty" json:"cert,omitempty"`
+	Key      string `yaml:"key,omitempty" json:"key,omitempty"`
+	SNIGuard string `yaml:"sniGuard,omitempty" json:"sniGuard,omitempty"`
+}
+
+type ACMEConfig struct {
+	Domains    []string        `yaml:"domains,omitempty" json:"domains,omitempty"`
+	Email      string          `yaml:"email,omitempty" json:"email,omitempty"`
+	CA         string          `yaml:"ca,omitempty" json:"ca,omitempty"`
+	ListenHost string          `yaml:"listenHost,omitempty" json:"listenHost,omitempty"`
+	Dir        string          `yaml:"dir,omitempty" json:"dir,omitempty"`
+	Type       string          `yaml:"type,omitempty" json:"type,omitempty"`
+	HTTP       *ACMEHTTPConfig `yaml:"http,omitempty" json:"http,omitempty"`
+	TLS        *ACMETLSConfig  `yaml:"tls,omitempty" json:"tls,omitempty"`
+	DNS        *ACMEDNSConfig  `yaml:"dns,omitempty" json:"dns,omitempty"`
+}
+
+type ACMEHTTPConfig struct {
+	AltPort int `yaml:"altPort,omitempty" json:"altPort,omitempty"`
+}
+
+type ACMETLSConfig struct {
+	AltPort int `yaml:"altPort,omitempty" json:"altPort,omitempty"`
+}
+
+type ACMEDNSConfig struct {
+	Name   string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Config map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+type ObfsConfig struct {
+	Type       string            `yaml:"type,omitempty" json:"type,omitempty"`
+	Salamander *SalamanderConfig `yaml:"salamander,omitempty" json:"salamander,omitempty"`
+}
+
+type SalamanderConfig struct {
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+type QUICConfig struct {
+	InitStreamReceiveWindow uint64 `yaml:"initStreamReceiveWindow,omitempty" json:"initStreamReceiveWindow,omitempty"`
+	MaxStreamReceiveWindow  uint64 `yaml:"maxStreamReceiveWindow,omitempty" json:"maxStreamReceiveWindow,omitempty"`
+	InitConnReceiveWindow   uint64 `yaml:"initConnReceiveWindow,omitempty" json:"initConnReceiveWindow,omitempty"`
+	MaxConnReceiveWindow    uint64 `yaml:"maxConnReceiveWindow,omitempty" json:"maxConnReceiveWindow,omitempty"`
+	MaxIdleTimeout          string `yaml:"maxIdleTimeout,omitempty" json:"maxIdleTimeout,omitempty"`
+	MaxIncomingStreams      int64  `yaml:"maxIncomingStreams,omitempty" json:"maxIncomingStreams,omitempty"`
+	DisablePathMTUDiscovery bool   `yaml:"disablePathMTUDiscovery,omitempty" json:"disablePathMTUDiscovery,omitempty"`
+}
+
+type BandwidthConfig struct {
+	Up   string `yaml:"up,omitempty" json:"up,omitempty"`
+	Down string `yaml:"down,omitempty" json:"down,omitempty"`
+}
+
+type AuthConfig struct {
+	Type     string            `yaml:"type,omitempty" json:"type,omitempty"`
+	Password string            `yaml:"password,omitempty" json:"password,omitempty"`
+	UserPass map[string]string `yaml:"userpass,omitempty" json:"userpass,omitempty"`
+	HTTP     *AuthHTTPConfig   `yaml:"http,omitempty" json:"http,omitempty"`
+	Command  string            `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+type AuthHTTPConfig struct {
+	URL      string `yaml:"url,omitempty" json:"url,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+type ACLConfig struct {
+	File              string   `yaml:"file,omitempty" json:"file,omitempty"`
+	Inline            []string `yaml:"inline,omitempty" json:"inline,omitempty"`
+	GeoIP             string   `yaml:"geoip,omitempty" json:"geoip,omitempty"`
+	GeoSite           string   `yaml:"geosite,omitempty" json:"geosite,omitempty"`
+	GeoUpdateInterval string   `yaml:"geoUpdateInterval,omitempty" json:"geoUpdateInterval,omitempty"`
+}
+
+type OutboundConfig struct {
+	Name   string                `yaml:"name" json:"name"`
+	Type   string                `yaml:"type" json:"type"`
+	Direct *OutboundDirectConfig `yaml:"direct,omitempty" json:"direct,omitempty"`
+	SOCKS5 *OutboundSOCKS5Config `yaml:"socks5,omitempty" json:"socks5,omitempty"`
+	HTTP   *OutboundHTTPConfig   `yaml:"http,omitempty" json:"http,omitempty"`
+}
+
+type OutboundDirectConfig struct {
+	Mode       string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	BindIPv4   string `yaml:"bindIPv4,omitempty" json:"bindIPv4,omitempty"`
+	BindIPv6   string `yaml:"bindIPv6,omitempty" json:"bindIPv6,omitempty"`
+	BindDevice string `yaml:"bindDevice,omitempty" json:"bindDevice,omitempty"`
+	FastOpen   bool   `yaml:"fastOpen,omitempty" json:"fastOpen,omitempty"`
+}
+
+type OutboundSOCKS5Config struct {
+	Addr     string `yaml:"addr,omitempty" json:"addr,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+type OutboundHTTPConfig struct {
+	URL      string `yaml:"url,omitempty" json:"url,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+type TrafficStatsConfig struct {
+	Listen string `yaml:"listen,omitempty" json:"listen,omitempty"`
+	Secret string `yaml:"secret,omitempty" json:"secret,omitempty"`
+}
+
+type MasqueradeConfig struct {
+	Type        string                  `yaml:"type,omitempty" json:"type,omitempty"`
+	File        *MasqueradeFileConfig   `yaml:"file,omitempty" json:"file,omitempty"`
+	Proxy       *MasqueradeProxyConfig  `yaml:"proxy,omitempty" json:"proxy,omitempty"`
+	String      *MasqueradeStringConfig `yaml:"string,omitempty" json:"string,omitempty"`
+	ListenHTTP  string                  `yaml:"listenHTTP,omitempty" json:"listenHTTP,omitempty"`
+	ListenHTTPS string                  `yaml:"listenHTTPS,omitempty" json:"listenHTTPS,omitempty"`
+	ForceHTTPS  bool                    `yaml:"forceHTTPS,omitempty" json:"forceHTTPS,omitempty"`
+}
+
+type MasqueradeFileConfig struct {
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+}
+
+type MasqueradeProxyConfig struct {
+	URL         string `yaml:"url,omitempty" json:"url,omitempty"`
+	RewriteHost bool   `yaml:"rewriteHost,omitempty" json:"rewriteHost,omitempty"`
+	Insecure    bool   `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+}
+
+type MasqueradeStringConfig struct {
+	Content    string            `yaml:"content,omitempty" json:"content,omitempty"`
+	Headers    map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	StatusCode int               `yaml:"statusCode,omitempty" json:"statusCode,omitempty"`
+}
+
+// 支持单独读写的配置段
+var ConfigSections = []string{
+	"listen", "tls", "acme", "obfs", "auth", "masquerade",
+	"bandwidth", "quic", "acl", "outbounds", "trafficStats",
+}
+
+var (
+	ErrUnknownSection      = fmt.Errorf("unknown config section")
+	ErrInvalidSectionPatch = fmt.Errorf("invalid config section")
+)
+
+// 解析YAML配置
+func ParseHysteria2Config(data []byte) (*Hysteria2Config, error) {
+	var cfg Hysteria2Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return &cfg, nil
+}
+
+// 监听端口，支持 ":443"、"0.0.0.0:443"、"[::]:443" 等形式
+func (c *Hysteria2Config) ListenPort() string {
+	listen := strings.TrimSpace(c.Listen)
+	if listen == "" {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// 获取某个配置段的指针，create为true时为空段分配内存
+func (c *Hysteria2Config) section(name string, create bool) (interface{}, error) {
+	switch name {
+	case "listen":
+		return &c.Listen, nil
+	case "tls":
+		if c.TLS == nil && create {
+			c.TLS = &TLSConfig{}
+		}
+		return &c.TLS, nil
+	case "acme":
+		if c.ACME == nil && create {
+			c.ACME = &ACMEConfig{}
+		}
+		return &c.ACME, nil
+	case "obfs":
+		if c.Obfs == nil && create {
+			c.Obfs = &ObfsConfig{}
+		}
+		return &c.Obfs, nil
+	case "auth":
+		if c.Auth == nil && create {
+			c.Auth = &AuthConfig{}
+		}
+		return &c.Auth, nil
+	case "masquerade":
+		if c.Masquerade == nil && create {
+			c.Masquerade = &MasqueradeConfig{}
+		}
+		return &c.Masquerade, nil
+	case "bandwidth":
+		if c.Bandwidth == nil && create {
+			c.Bandwidth = &BandwidthConfig{}
+		}
+		return &c.Bandwidth, nil
+	case "quic":
+		if c.QUIC == nil && create {
+			c.QUIC = &QUICConfig{}
+		}
+		return &c.QUIC, nil
+	case "acl":
+		if c.ACL == nil && create {
+			c.ACL = &ACLConfig{}
+		}
+		return &c.ACL, nil
+	case "outbounds":
+		return &c.Outbounds, nil
+	case "trafficStats":
+		if c.TrafficStats == nil && create {
+			c.TrafficStats = &TrafficStatsConfig{}
+		}
+		return &c.TrafficStats, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSection, name)
+}
+
+// 读取并解析当前配置
+func (h *Hysteria2Service) GetParsedConfig() (*Hysteria2Config, error) {
+	data, err := os.ReadFile(hysteriaConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseHysteria2Config(data)
+}
+
+// 获取单个配置段
+func (h *Hysteria2Service) GetConfigSection(name string) (interface{}, error) {
+	cfg, err := h.GetParsedConfig()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.section(name, false)
+}
+
+// 在当前配置上按 JSON Merge Patch 合并配置段，未出现的字段保持不变，返回修改后的配置段和完整配置，不写入文件
+// 修改在节点树上进行，其余部分的注释和格式保持不变
+func (h *Hysteria2Service) PatchedConfigSection(name string, patch []byte) (interface{}, []byte, error) {
+	// 先确认配置段存在
+	if _, err := (&Hysteria2Config{}).section(name, false); err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := h.GetConfigDocument()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := doc.MergePatch(patch, name); err != nil {
+		return nil, nil, fmt.Errorf("%w %s: %v", ErrInvalidSectionPatch, name, err)
+	}
+
+	// 检查修改后的字段类型
+	cfg, err := doc.Config()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w %s: %v", ErrInvalidSectionPatch, name, err)
+	}
+	target, err := cfg.section(name, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := doc.Bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	return target, data, nil
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 校验发现的问题
+type ConfigFinding struct {
+	Field   string `json:"field,omitempty"` // 出问题的字段路径，如 "auth.password"
+	Message string `json:"message"`
+}
+
+// 配置校验结果
+type ConfigValidation struct {
+	Valid    bool            `json:"valid"`
+	Errors   []ConfigFinding `json:"errors"`
+	Warnings []ConfigFinding `json:"warnings"`
+}
+
+func (v *ConfigValidation) addError(field, format string, args ...interface{}) {
+	v.Errors = append(v.Errors, ConfigFinding{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *ConfigValidation) addWarning(field, format string, args ...interface{}) {
+	v.Warnings = append(v.Warnings, ConfigFinding{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// 类型模型中未建模、但 hysteria 支持的顶层字段
+var extraTopLevelKeys = map[string]bool{
+	"resolver":              true,
+	"sniff":                 true,
+	"speedTest":             true,
+	"disableUDP":            true,
+	"udpIdleTimeout":        true,
+	"ignoreClientBandwidth": true,
+}
+
+// 带宽格式，如 "100 mbps"、"1gbps"、"50m"
+var bandwidthPattern = regexp.MustCompile(`(?i)^\d+(\.\d+)?\s*(b|bps|k|kb|kbps|m|mb|mbps|g|gb|gbps|t|tb|tbps)?$`)
+
+// 校验候选配置，不会修改当前配置文件
+func (h *Hysteria2Service) ValidateConfig(config string) *ConfigValidation {
+	v := &ConfigValidation{
+		Errors:   []ConfigFinding{},
+		Warnings: []ConfigFinding{},
+	}
+
+	// YAML 语法
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(config), &root); err != nil {
+		v.addError("", "invalid YAML: %v", err)
+		return v
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		v.addError("", "config must be a YAML mapping")
+		return v
+	}
+
+	cfg, err := ParseHysteria2Config([]byte(config))
+	if err != nil {
+		v.addError("", "%v", err)
+		return v
+	}
+
+	// 未知字段
+	checkUnknownKeys(root.Content[0], reflect.TypeOf(Hysteria2Config{}), "", v)
+
+	h.validateListen(cfg, v)
+	validateTLS(cfg, v)
+	validateAuth(cfg, v)
+	validateObfs(cfg, v)
+	validateBandwidth(cfg, v)
+
+	v.Valid = len(v.Errors) == 0
+	return v
+}
+
+// 按类型模型检查未知字段
+func checkUnknownKeys(node *yaml.Node, t reflect.Type, path string, v *ConfigValidation) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			checkUnknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), v)
+		}
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name != "" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			fieldType, ok := fields[key]
+			if !ok {
+				if path == "" && extraTopLevelKeys[key] {
+					continue
+				}
+				v.addWarning(fieldPath, "unknown key %q", key)
+				continue
+			}
+			checkUnknownKeys(node.Content[i+1], fieldType, fieldPath, v)
+		}
+	}
+}
+
+// 校验监听地址及端口占用
+func (h *Hysteria2Service) validateListen(cfg *Hysteria2Config, v *ConfigValidation) {
+	listen := strings.TrimSpace(cfg.Listen)
+	if listen == "" {
+		v.addWarning("listen", "listen is empty, hysteria will use the default :443")
+		listen = ":443"
+	}
+	if _, _, err := net.SplitHostPort(listen); err != nil {
+		v.addError("listen", "invalid listen address %q: %v", listen, err)
+		return
+	}
+
+	conn, err := net.ListenPacket("udp", listen)
+	if err == nil {
+		conn.Close()
+		return
+	}
+
+	// 端口被占用时，若占用者是正在运行的 hysteria 本身则忽略，应用配置时会重启
+	check := h.CheckListener(listen)
+	if check.State == PortBoundByHysteria {
+		return
+	}
+	for _, other := range check.Others {
+		if other.PID != 0 {
+			v.addError("listen", "port %d is already bound by %s (pid %d)", check.Port, other.Process, other.PID)
+			return
+		}
+	}
+	_, port, _ := net.SplitHostPort(listen)
+	v.addError("listen", "port %s is already bound by another process", port)
+}
+
+// 校验证书配置
+func validateTLS(cfg *Hysteria2Config, v *ConfigValidation) {
+	if cfg.TLS == nil && cfg.ACME == nil {
+		v.addError("tls", "either tls or acme must be configured")
+		return
+	}
+	if cfg.TLS != nil && cfg.ACME != nil {
+		v.addError("tls", "tls and acme cannot be configured at the same time")
+	}
+
+	if cfg.TLS != nil {
+		checkReadable("tls.cert", cfg.TLS.Cert, v)
+		checkReadable("tls.key", cfg.TLS.Key, v)
+	}
+	if cfg.ACME != nil && len(cfg.ACME.Domains) == 0 {
+		v.addError("acme.domains", "acme.domains is required")
+	}
+}
+
+func checkReadable(field, path string, v *ConfigValidation) {
+	if path == "" {
+		v.addError(field, "%s is required", field)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		v.addError(field, "cannot read %s: %v", path, err)
+		return
+	}
+	f.Close()
+}
+
+// 按认证类型校验必填字段
+func validateAuth(cfg *Hysteria2Config, v *ConfigValidation) {
+	if cfg.Auth == nil {
+		v.addError("auth", "auth is required")
+		return
+	}
+
+	switch cfg.Auth.Type {
+	case "password":
+		if cfg.Auth.Password == "" {
+			v.addError("auth.password", "auth.password is required for password auth")
+		}
+	case "userpass":
+		if len(cfg.Auth.UserPass) == 0 {
+			v.addError("auth.userpass", "auth.userpass must contain at least one user")
+		}
+		for user, pass := range cfg.Auth.UserPass {
+			if pass == "" {
+				v.addError("auth.userpass."+user, "password of user %q is empty", user)
+			}
+		}
+	case "http":
+		if cfg.Auth.HTTP == nil || cfg.Auth.HTTP.URL == "" {
+			v.addError("auth.http.url", "auth.http.url is required for http auth")
+		}
+	case "command":
+		if cfg.Auth.Command == "" {
+			v.addError("auth.command", "auth.command is required for command auth")
+		}
+	case "":
+		v.addError("auth.type", "auth.type is required")
+	default:
+		v.addError("auth.type", "unsupported auth type %q", cfg.Auth.Type)
+	}
+}
+
+// 校验混淆配置
+func validateObfs(cfg *Hysteria2Config, v *ConfigValidation) {
+	if cfg.Obfs == nil {
+		return
+	}
+	switch cfg.Obfs.Type {
+	case "salamander":
+		if cfg.Obfs.Salamander == nil || cfg.Obfs.Salamander.Password == "" {
+			v.addError("obfs.salamander.password", "obfs.salamander.password is required")
+		}
+	default:
+		v.addError("obfs.type", "unsupported obfs type %q", cfg.Obfs.Type)
+	}
+}
+
+// 校验带宽格式
+func validateBandwidth(cfg *Hysteria2Config, v *ConfigValidation) {
+	if cfg.Bandwidth == nil {
+		return
+	}
+	if cfg.Bandwidth.Up != "" && !bandwidthPattern.MatchString(strings.TrimSpace(cfg.Bandwidth.Up)) {
+		v.addError("bandwidth.up", "malformed bandwidth %q", cfg.Bandwidth.Up)
+	}
+	if cfg.Bandwidth.Down != "" && !bandwidthPattern.MatchString(strings.TrimSpace(cfg.Bandwidth.Down)) {
+		v.addError("bandwidth.down", "malformed bandwidth %q", cfg.Bandwidth.Down)
+	}
+}
@@ -0,0 +1,551 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultReleaseBaseURL = "https://github.com/apernet/hysteria/releases"
+
+	hysteriaBinaryPath = "/usr/local/bin/hysteria"
+	hysteriaUnitPath   = "/etc/systemd/system/hysteria-server.service"
+	hysteriaUser       = "hysteria"
+	hysteriaHomeDir    = "/var/lib/hysteria" // 服务的工作目录，ACME 证书默认保存在其中的 acme 目录
+	releaseHashesFile  = "hashes.txt"
+)
+
+var (
+	ErrInvalidVersion      = fmt.Errorf("invalid version")
+	ErrUnsupportedPlatform = fmt.Errorf("unsupported platform")
+	ErrChecksumMismatch    = fmt.Errorf("checksum mismatch")
+
+	versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(-[0-9A-Za-z.]+)?$`)
+)
+
+// 官方发布的架构
+var releaseArches = map[string]bool{
+	"amd64": true, "386": true, "arm64": true, "arm": true,
+	"s390x": true, "mipsle": true, "riscv64": true, "loong64": true,
+}
+
+// 与官方安装脚本一致的 systemd 服务单元
+const hysteriaUnit = `[Unit]
+Description=Hysteria Server Service (config.yaml)
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=/usr/local/bin/hysteria server --config /etc/hysteria/config.yaml
+WorkingDirectory=~
+User=hysteria
+Group=hysteria
+Environment=HYSTERIA_LOG_LEVEL=info
+CapabilityBoundingSet=CAP_NET_ADMIN CAP_NET_BIND_SERVICE CAP_NET_RAW
+AmbientCapabilities=CAP_NET_ADMIN CAP_NET_BIND_SERVICE CAP_NET_RAW
+NoNewPrivileges=true
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// hysteria 发布源，可以替换为本地镜像或测试服务器
+type ReleaseSource interface {
+	// 最新版本号，如 v2.6.0
+	LatestVersion(ctx context.Context) (string, error)
+	// 打开某个版本中的文件
+	Open(ctx context.Context, version, name string) (io.ReadCloser, error)
+}
+
+// 按 GitHub Releases 的目录结构访问发布文件：
+// {base}/latest 跳转到最新版本，文件位于 {base}/download/app/{version}/{name}
+type HTTPReleaseSource struct {
+	BaseURL string
+	client  *http.Client
+}
+
+func NewHTTPReleaseSource(baseURL string) *HTTPReleaseSource {
+	if baseURL == "" {
+		baseURL = DefaultReleaseBaseURL
+	}
+	return &HTTPReleaseSource{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// 从 {base}/latest 的跳转地址中获取版本号，镜像也可以直接在响应体中返回版本号
+func (s *HTTPReleaseSource) LatestVersion(ctx context.Context) (string, error) {
+	client := *s.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/latest", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var version string
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		location, err := url.PathUnescape(resp.Header.Get("Location"))
+		if err != nil {
+			return "", err
+		}
+		version = path.Base(location)
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+		if err != nil {
+			return "", err
+		}
+		version = strings.TrimSpace(string(body))
+	default:
+		return "", fmt.Errorf("failed to get latest version: %s", resp.Status)
+	}
+	return NormalizeVersion(version)
+}
+
+func (s *HTTPReleaseSource) Open(ctx context.Context, version, name string) (io.ReadCloser, error) {
+	fileURL := fmt.Sprintf("%s/download/app/%s/%s", s.BaseURL, version, url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %s", fileURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// 安装结果
+type InstallResult struct {
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	Asset           string `json:"asset"`
+	SHA256          string `json:"sha256"`
+	Restarted       bool   `json:"restarted"`
+}
+
+// 新版本启动失败时返回的结构化错误
+type InstallError struct {
+	Version         string `json:"version"`                    // 启动失败的版本
+	Reason          string `json:"reason"`                     // 从日志中获取的失败原因
+	RolledBack      bool   `json:"rolled_back"`                // 是否已回滚
+	RestoredVersion string `json:"restored_version,omitempty"` // 回滚后的版本
+	RollbackError   string `json:"rollback_error,omitempty"`   // 回滚本身失败的原因
+}
+
+func (e *InstallError) Error() string {
+	msg := fmt.Sprintf("hysteria %s failed to start: %s", e.Version, e.Reason)
+	if e.RolledBack {
+		msg += fmt.Sprintf(" (rolled back to %s)", e.RestoredVersion)
+	} else if e.RollbackError != "" {
+		msg += fmt.Sprintf(" (rollback failed: %s)", e.RollbackError)
+	}
+	return msg
+}
+
+var ErrNoRollbackTarget = fmt.Errorf("no previous binary to roll back to")
+
+// 原生安装 hysteria：下载对应平台的二进制文件，校验 SHA-256 后原子替换，并维护 systemd 服务
+// 安装过的二进制文件保存在历史记录中，新版本启动失败时自动切换回原来的版本
+type Installer struct {
+	source     ReleaseSource
+	hy2Service *Hysteria2Service
+	history    *BinaryHistory
+	binaryPath string
+	unitPath   string
+
+	ctx context.Context
+	out io.Writer
+}
+
+func NewInstaller(source ReleaseSource) *Installer {
+	return &Installer{
+		source:     source,
+		hy2Service: NewHysteria2Service(),
+		history:    NewBinaryHistory(),
+		binaryPath: hysteriaBinaryPath,
+		unitPath:   hysteriaUnitPath,
+		ctx:        context.Background(),
+		out:        io.Discard,
+	}
+}
+
+// 返回使用指定上下文和输出的副本，用于在后台任务中执行并记录进度
+// 安装、更新和回滚在 ctx 上获取操作锁，ctx 已持有锁时不再重复获取
+func (i *Installer) WithContext(ctx context.Context, out io.Writer) *Installer {
+	c := *i
+	c.ctx = ctx
+	c.out = out
+	return &c
+}
+
+// 输出一行进度
+func (i *Installer) logf(format string, args ...interface{}) {
+	fmt.Fprintf(i.out, format+"\n", args...)
+}
+
+// 校验并规范化版本号，统一带 v 前缀
+func NormalizeVersion(version string) (string, error) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "app/")
+	if !versionPattern.MatchString(version) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidVersion, version)
+	}
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version, nil
+}
+
+// 当前平台对应的发布文件名
+func ReleaseAsset() (string, error) {
+	if runtime.GOOS != "linux" || !releaseArches[runtime.GOARCH] {
+		return "", fmt.Errorf("%w: %s/%s", ErrUnsupportedPlatform, runtime.GOOS, runtime.GOARCH)
+	}
+	return fmt.Sprintf("hysteria-%s-%s", runtime.GOOS, runtime.GOARCH), nil
+}
+
+// 安装最新版本并设置开机自启
+func (i *Installer) Install() (*InstallResult, error) {
+	lease, ctx, err := BeginOperation(i.ctx, "install")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	i = i.WithContext(ctx, i.out)
+
+	result, err := i.InstallVersion("")
+	if err != nil {
+		return nil, err
+	}
+	if err := i.enableService(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 更新到最新版本
+func (i *Installer) Update() (*InstallResult, error) {
+	lease, ctx, err := BeginOperation(i.ctx, "update")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	i = i.WithContext(ctx, i.out)
+
+	return i.InstallVersion("")
+}
+
+// 安装指定版本，version 为空时安装最新版本
+// 服务正在运行时会重启，新版本无法稳定运行时自动回滚到原来的版本
+func (i *Installer) InstallVersion(version string) (*InstallResult, error) {
+	lease, ctx, err := BeginOperation(i.ctx, "install_version")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	i = i.WithContext(ctx, i.out)
+
+	if version == "" {
+		i.logf("Resolving latest version from %s", sourceName(i.source))
+		version, err = i.source.LatestVersion(i.ctx)
+	} else {
+		version, err = NormalizeVersion(version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	asset, err := ReleaseAsset()
+	if err != nil {
+		return nil, err
+	}
+	i.logf("Installing hysteria %s (%s)", version, asset)
+	expected, err := i.expectedHash(version, asset)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.install(version, asset, func() (*BinaryVersion, error) {
+		return i.download(version, asset, expected)
+	})
+}
+
+// 网络安装和上传安装共用的流程：保存当前版本，通过 fetch 获得新版本的二进制文件，
+// 原子替换并更新 systemd 服务，服务正在运行时重启，失败时回滚
+func (i *Installer) install(version, asset string, fetch func() (*BinaryVersion, error)) (*InstallResult, error) {
+	result := &InstallResult{
+		Version:         version,
+		PreviousVersion: i.hy2Service.GetVersion(),
+		Asset:           asset,
+	}
+	previous := i.archiveCurrent()
+	if previous != nil && previous.Version == version {
+		previous = nil
+	}
+
+	entry, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if err := i.ctx.Err(); err != nil {
+		return nil, err
+	}
+	result.SHA256 = entry.SHA256
+	i.logf("Replacing %s", i.binaryPath)
+	if err := copyExecutable(i.history.Path(entry), i.binaryPath); err != nil {
+		return nil, err
+	}
+	if err := i.writeUnit(); err != nil {
+		return nil, err
+	}
+
+	if unit, err := i.hy2Service.unitStatus(); err == nil && unit.ActiveState == "active" {
+		i.logf("Restarting %s", hysteriaUnitName)
+		result.Restarted = true
+		if err := i.restartOrRollback(version, previous); err != nil {
+			return nil, err
+		}
+	}
+	i.logf("Installed hysteria %s", version)
+	return result, nil
+}
+
+// 已保存的二进制文件，按安装时间倒序
+func (i *Installer) ListBinaries() ([]BinaryVersion, error) {
+	return i.history.List()
+}
+
+// 切换到历史记录中的版本并重启，version 为空时切换到上一个版本
+func (i *Installer) Rollback(version string) (*InstallResult, error) {
+	lease, ctx, err := BeginOperation(i.ctx, "rollback")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	i = i.WithContext(ctx, i.out)
+
+	current, _ := NormalizeVersion(i.hy2Service.GetVersion())
+
+	var target *BinaryVersion
+	if version != "" {
+		version, err := NormalizeVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		if target, err = i.history.Get(version); err != nil {
+			return nil, err
+		}
+	} else {
+		versions, err := i.history.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range versions {
+			if v.Version != current {
+				target = &v
+				break
+			}
+		}
+		if target == nil {
+			return nil, ErrNoRollbackTarget
+		}
+	}
+
+	previous := i.archiveCurrent()
+	if err := copyExecutable(i.history.Path(target), i.binaryPath); err != nil {
+		return nil, err
+	}
+	result := &InstallResult{
+		Version:         target.Version,
+		PreviousVersion: current,
+		Asset:           target.File,
+		SHA256:          target.SHA256,
+		Restarted:       true,
+	}
+	if err := i.restartOrRollback(target.Version, previous); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 把当前安装的二进制保存到历史记录，用于启动失败时回滚；无法识别版本时返回 nil
+func (i *Installer) archiveCurrent() *BinaryVersion {
+	version, err := NormalizeVersion(i.hy2Service.GetVersion())
+	if err != nil {
+		return nil
+	}
+	entry, err := i.history.Add(version, i.binaryPath, false)
+	if err != nil {
+		log.Printf("保存当前 hysteria 二进制文件失败: %v", err)
+		return nil
+	}
+	return entry
+}
+
+// 重启并在观察窗口内等待服务稳定，失败时切换回 previous 并再次重启
+func (i *Installer) restartOrRollback(version string, previous *BinaryVersion) error {
+	since := time.Now()
+	reason := i.hy2Service.restartAndSettle()
+	if reason == "" {
+		return nil
+	}
+
+	installErr := &InstallError{Version: version, Reason: reason}
+	if journalErr := i.hy2Service.lastJournalError(since); journalErr != "" {
+		installErr.Reason = journalErr
+	}
+	i.logf("Service failed to start: %s", installErr.Reason)
+	if previous == nil {
+		installErr.RollbackError = "no previous binary available"
+		return installErr
+	}
+	i.logf("Rolling back to %s", previous.Version)
+	if err := copyExecutable(i.history.Path(previous), i.binaryPath); err != nil {
+		installErr.RollbackError = fmt.Sprintf("failed to restore binary: %v", err)
+		return installErr
+	}
+	if rollbackReason := i.hy2Service.restartAndSettle(); rollbackReason != "" {
+		installErr.RollbackError = fmt.Sprintf("service did not recover after rollback: %s", rollbackReason)
+		return installErr
+	}
+
+	installErr.RolledBack = true
+	installErr.RestoredVersion = previous.Version
+	return installErr
+}
+
+// 从发布的 hashes.txt 中获取文件的 SHA-256
+func (i *Installer) expectedHash(version, asset string) (string, error) {
+	reader, err := i.source.Open(i.ctx, version, releaseHashesFile)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	// 每行格式为 "<sha256>  <路径>"，路径可能带有目录前缀
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum for %s in %s %s", asset, version, releaseHashesFile)
+}
+
+// 下载到历史记录目录中，校验通过后保存
+func (i *Installer) download(version, asset, expected string) (*BinaryVersion, error) {
+	i.logf("Downloading %s", asset)
+	reader, err := i.source.Open(i.ctx, version, asset)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(i.history.dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(i.history.dir, ".download-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	progress := &downloadProgress{installer: i}
+	if _, err := io.Copy(io.MultiWriter(tmp, hash, progress), reader); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return nil, fmt.Errorf("%w: %s expected %s, got %s", ErrChecksumMismatch, asset, expected, actual)
+	}
+	i.logf("Downloaded %d bytes, SHA-256 verified: %s", progress.n, actual)
+	return i.history.Add(version, tmp.Name(), true)
+}
+
+// 写入或更新 systemd 服务单元，并确保运行用户存在
+func (i *Installer) writeUnit() error {
+	if exec.Command("id", hysteriaUser).Run() != nil {
+		output, err := exec.Command("useradd", "--system", "--create-home", "--home-dir", hysteriaHomeDir, "--shell", "/usr/sbin/nologin", hysteriaUser).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to create user %s: %s", hysteriaUser, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if current, err := os.ReadFile(i.unitPath); err == nil && string(current) == hysteriaUnit {
+		return nil
+	}
+	if err := os.WriteFile(i.unitPath, []byte(hysteriaUnit), 0644); err != nil {
+		return err
+	}
+	return i.hy2Service.units.Reload(i.ctx)
+}
+
+// 设置开机自启
+func (i *Installer) enableService() error {
+	i.logf("Enabling %s", hysteriaUnitName)
+	return i.hy2Service.units.Enable(i.ctx, hysteriaUnitName)
+}
+
+// 发布源的名称，用于输出进度
+func sourceName(source ReleaseSource) string {
+	if s, ok := source.(*HTTPReleaseSource); ok {
+		return s.BaseURL
+	}
+	return fmt.Sprintf("%T", source)
+}
+
+// 下载时每 10MB 输出一次进度
+type downloadProgress struct {
+	installer *Installer
+	n         int64
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	const step = 10 << 20
+	before := p.n / step
+	p.n += int64(len(b))
+	if p.n/step > before {
+		p.installer.logf("Downloaded %d MB", p.n>>20)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := map[string]string{
+		"v2.6.0":            "v2.6.0",
+		"2.6.0":             "v2.6.0",
+		" v2.6.0\n":         "v2.6.0",
+		"app/v2.6.0":        "v2.6.0",
+		"v2.6.0-beta.1":     "v2.6.0-beta.1",
+		"2.10.12-rc1":       "v2.10.12-rc1",
+		"app/2.6.0-alpha.2": "v2.6.0-alpha.2",
+	}
+	for input, want := range tests {
+		got, err := NormalizeVersion(input)
+		if err != nil || got != want {
+			t.Errorf("NormalizeVersion(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+}
+
+func TestNormalizeVersionInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"latest",
+		"v2.6",
+		"v2.6.0.1",
+		"vv2.6.0",
+		"2.6.0-",
+		"2.6.0-beta 1",
+		"../v2.6.0",
+		"v2.6.0/../../etc",
+		"app/app/v2.6.0",
+	} {
+		if got, err := NormalizeVersion(input); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("NormalizeVersion(%q) = %q, %v; want ErrInvalidVersion", input, got, err)
+		}
+	}
+}
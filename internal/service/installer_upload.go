@@ -0,0 +1,214 @@
+package service
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	maxUploadSize        = 200 << 20 // 上传文件的最大字节数
+	uploadVersionTimeout = 10 * time.Second
+)
+
+var (
+	ErrInvalidUpload = fmt.Errorf("invalid upload")
+
+	sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// 离线安装：上传 hysteria 二进制文件，或包含二进制文件和校验文件的 tar/tar.gz 包
+// 二进制文件需要能在本机运行并通过 "hysteria version" 报告版本，随后走与网络安装相同的流程
+// checksum 为上传二进制文件时可选的 SHA-256，压缩包中必须包含校验文件
+func (i *Installer) InstallUpload(r io.Reader, filename, checksum string) (*InstallResult, error) {
+	if checksum != "" && !sha256Pattern.MatchString(checksum) {
+		return nil, fmt.Errorf("%w: invalid sha256 %q", ErrInvalidUpload, checksum)
+	}
+
+	if err := os.MkdirAll(i.history.dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(i.history.dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	asset, expected, err := extractUpload(r, filename, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if expected == "" {
+		expected = checksum
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	actual, _, err := fileSHA256(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if expected != "" && !strings.EqualFold(actual, expected) {
+		return nil, fmt.Errorf("%w: checksum mismatch, expected %s, got %s", ErrInvalidUpload, expected, actual)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return nil, err
+	}
+	version, err := binaryVersion(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	lease, ctx, err := BeginOperation(i.ctx, "install_upload")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	i = i.WithContext(ctx, i.out)
+
+	i.logf("Installing uploaded hysteria %s (%s)", version, asset)
+
+	result, err := i.install(version, asset, func() (*BinaryVersion, error) {
+		return i.history.Add(version, tmp.Name(), true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.enableService(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 把上传的二进制文件写入 dst，压缩包时返回包中的二进制文件名和校验文件中的 SHA-256
+func extractUpload(r io.Reader, filename string, dst io.Writer) (string, string, error) {
+	reader := bufio.NewReader(io.LimitReader(r, maxUploadSize+1))
+
+	// 通过文件头判断格式，不依赖文件名
+	head, _ := reader.Peek(512)
+	var archive io.Reader
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+		}
+		defer gz.Close()
+		archive = gz
+	case len(head) > 262 && string(head[257:262]) == "ustar":
+		archive = reader
+	default:
+		n, err := io.Copy(dst, reader)
+		if err != nil {
+			return "", "", err
+		}
+		if n > maxUploadSize {
+			return "", "", fmt.Errorf("%w: file exceeds %d bytes", ErrInvalidUpload, maxUploadSize)
+		}
+		return path.Base(filename), "", nil
+	}
+
+	var binaryName string
+	var checksumFiles [][]byte
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Base(header.Name)
+		switch {
+		case isChecksumFile(name):
+			data, err := io.ReadAll(io.LimitReader(tr, 64<<10))
+			if err != nil {
+				return "", "", err
+			}
+			checksumFiles = append(checksumFiles, data)
+		case strings.HasPrefix(name, "hysteria"):
+			if binaryName != "" {
+				return "", "", fmt.Errorf("%w: multiple binaries in archive: %s, %s", ErrInvalidUpload, binaryName, name)
+			}
+			n, err := io.CopyN(dst, tr, maxUploadSize+1)
+			if err != nil && err != io.EOF {
+				return "", "", err
+			}
+			if n > maxUploadSize {
+				return "", "", fmt.Errorf("%w: binary exceeds %d bytes", ErrInvalidUpload, maxUploadSize)
+			}
+			binaryName = name
+		}
+	}
+	if binaryName == "" {
+		return "", "", fmt.Errorf("%w: no hysteria binary in archive", ErrInvalidUpload)
+	}
+
+	for _, data := range checksumFiles {
+		if sum := findChecksum(data, binaryName); sum != "" {
+			return binaryName, sum, nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: no checksum for %s in archive", ErrInvalidUpload, binaryName)
+}
+
+func isChecksumFile(name string) bool {
+	lower := strings.ToLower(name)
+	return lower == releaseHashesFile || strings.HasSuffix(lower, ".sha256") ||
+		strings.HasPrefix(lower, "sha256sum") || strings.HasPrefix(lower, "checksums")
+}
+
+// 在校验文件中查找文件的 SHA-256，支持 "<sha256>  <文件名>" 格式和只有一个哈希值的文件
+func findChecksum(data []byte, name string) string {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == name:
+			return strings.ToLower(fields[0])
+		case len(fields) == 1 && len(lines) == 1 && sha256Pattern.MatchString(fields[0]):
+			return strings.ToLower(fields[0])
+		}
+	}
+	return ""
+}
+
+// 运行二进制文件获取版本号，同时确认它能在本机运行
+func binaryVersion(binary string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadVersionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, binary, "version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%w: binary cannot run on this host: %v %s", ErrInvalidUpload, err, strings.TrimSpace(string(output)))
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Version:") {
+			version, err := NormalizeVersion(strings.TrimSpace(strings.TrimPrefix(line, "Version:")))
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+			}
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no version reported by \"hysteria version\"", ErrInvalidUpload)
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFindChecksum(t *testing.T) {
+	const (
+		sumA = "9a3a45d0d4d1e6e1f1d7c7d0b6a6d6e6f6a6b6c6d6e6f6a6b6c6d6e6f6a6b6c6"
+		sumB = "ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789"
+	)
+	tests := []struct {
+		name string
+		data string
+		file string
+		want string
+	}{
+		{
+			name: "hashes.txt from a release",
+			data: sumA + "  build/hysteria-linux-amd64\n" + sumB + "  build/hysteria-linux-arm64\n",
+			file: "hysteria-linux-arm64",
+			want: strings.ToLower(sumB),
+		},
+		{
+			name: "sha256sum binary mode",
+			data: sumA + " *hysteria-linux-amd64\n",
+			file: "hysteria-linux-amd64",
+			want: sumA,
+		},
+		{
+			name: "single hash",
+			data: sumB + "\n",
+			file: "hysteria",
+			want: strings.ToLower(sumB),
+		},
+		{
+			name: "CRLF line endings",
+			data: sumA + "  hysteria-linux-amd64\r\n" + sumB + "  hysteria-linux-arm64\r\n",
+			file: "hysteria-linux-amd64",
+			want: sumA,
+		},
+		{
+			name: "no entry for the file",
+			data: sumA + "  hysteria-linux-amd64\n",
+			file: "hysteria-linux-arm64",
+			want: "",
+		},
+		{
+			name: "single value that is not a hash",
+			data: "not-a-hash\n",
+			file: "hysteria",
+			want: "",
+		},
+		{
+			name: "single hash among several lines",
+			data: sumA + "\n" + sumB + "\n",
+			file: "hysteria",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		if got := findChecksum([]byte(tt.data), tt.file); got != tt.want {
+			t.Errorf("%s: findChecksum = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+type tarEntry struct {
+	name string
+	data string
+	dir  bool
+}
+
+func buildTar(t *testing.T, entries []tarEntry, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	var tw *tar.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0755, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		if e.dir {
+			header = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExtractUploadBinary(t *testing.T) {
+	const binary = "\x7fELF fake hysteria binary"
+	var dst bytes.Buffer
+	asset, sum, err := extractUpload(strings.NewReader(binary), "uploads/hysteria-linux-amd64", &dst)
+	if err != nil {
+		t.Fatalf("extractUpload: %v", err)
+	}
+	if asset != "hysteria-linux-amd64" || sum != "" || dst.String() != binary {
+		t.Errorf("extractUpload = %q, %q, %q; want hysteria-linux-amd64, empty checksum, binary", asset, sum, dst.String())
+	}
+}
+
+func TestExtractUploadArchive(t *testing.T) {
+	const binary = "\x7fELF fake hysteria binary"
+	entries := []tarEntry{
+		{name: "release/", dir: true},
+		{name: "release/README.md", data: "readme"},
+		{name: "release/hysteria-linux-amd64", data: binary},
+		{name: "release/hashes.txt", data: sha256Hex(binary) + "  build/hysteria-linux-amd64\n"},
+	}
+
+	for _, compress := range []bool{false, true} {
+		var dst bytes.Buffer
+		// 文件名与内容不符时仍按文件头识别
+		asset, sum, err := extractUpload(bytes.NewReader(buildTar(t, entries, compress)), "upload.bin", &dst)
+		if err != nil {
+			t.Fatalf("gzip=%v: extractUpload: %v", compress, err)
+		}
+		if asset != "hysteria-linux-amd64" || sum != sha256Hex(binary) || dst.String() != binary {
+			t.Errorf("gzip=%v: extractUpload = %q, %q, %q", compress, asset, sum, dst.String())
+		}
+	}
+}
+
+func TestExtractUploadArchiveErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{
+			name:    "no binary",
+			entries: []tarEntry{{name: "hashes.txt", data: sha256Hex("x") + "  hysteria\n"}},
+		},
+		{
+			name: "no checksum",
+			entries: []tarEntry{
+				{name: "hysteria-linux-amd64", data: "binary"},
+				{name: "README.md", data: "readme"},
+			},
+		},
+		{
+			name: "checksum for another file",
+			entries: []tarEntry{
+				{name: "hysteria-linux-amd64", data: "binary"},
+				{name: "hysteria-linux-amd64.sha256", data: sha256Hex("binary") + "  hysteria-linux-arm64\n"},
+			},
+		},
+		{
+			name: "multiple binaries",
+			entries: []tarEntry{
+				{name: "hysteria-linux-amd64", data: "a"},
+				{name: "hysteria-linux-arm64", data: "b"},
+				{name: "hashes.txt", data: sha256Hex("a") + "  hysteria-linux-amd64\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		var dst bytes.Buffer
+		_, _, err := extractUpload(bytes.NewReader(buildTar(t, tt.entries, true)), "hysteria.tar.gz", &dst)
+		if !errors.Is(err, ErrInvalidUpload) {
+			t.Errorf("%s: extractUpload error = %v, want ErrInvalidUpload", tt.name, err)
+		}
+	}
+}
+
+func TestExtractUploadCorruptGzip(t *testing.T) {
+	var dst bytes.Buffer
+	_, _, err := extractUpload(bytes.NewReader([]byte{0x1f, 0x8b, 0x00, 0x01}), "hysteria.tar.gz", &dst)
+	if !errors.Is(err, ErrInvalidUpload) {
+		t.Errorf("extractUpload error = %v, want ErrInvalidUpload", err)
+	}
+}
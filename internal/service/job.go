@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	jobHistoryDir = "/var/lib/hy2agent/jobs"
+	maxJobHistory = 50      // 保留的已结束任务数量
+	maxJobOutput  = 1 << 20 // 单个任务保存的最大输出字节数
+)
+
+// 任务状态
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+var (
+	ErrJobNotFound = fmt.Errorf("job not found")
+	ErrJobFinished = fmt.Errorf("job already finished")
+)
+
+// 任务执行函数，输出写入 out，ctx 在任务取消时结束
+// 返回的 result 会保存在任务中，出错时也可以返回结构化的错误详情
+type JobFunc func(ctx context.Context, out io.Writer) (interface{}, error)
+
+// 后台任务
+type Job struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	State     string      `json:"state"`
+	CreatedAt time.Time   `json:"created_at"`
+	StartedAt *time.Time  `json:"started_at,omitempty"`
+	EndedAt   *time.Time  `json:"ended_at,omitempty"`
+	ExitCode  *int        `json:"exit_code,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+	Output    string      `json:"output"`
+	Truncated bool        `json:"output_truncated,omitempty"` // 输出超过上限，之后的内容被丢弃
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	changed chan struct{} // 状态或输出变化时关闭并替换，用于通知订阅者
+}
+
+// 任务快照，offset 之前的输出不返回
+type JobSnapshot struct {
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	State        string      `json:"state"`
+	CreatedAt    time.Time   `json:"created_at"`
+	StartedAt    *time.Time  `json:"started_at,omitempty"`
+	EndedAt      *time.Time  `json:"ended_at,omitempty"`
+	ExitCode     *int        `json:"exit_code,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	Result       interface{} `json:"result,omitempty"`
+	Output       string      `json:"output"`
+	OutputOffset int         `json:"output_offset"` // 本次返回的输出在完整输出中的起始位置
+	OutputSize   int         `json:"output_size"`   // 完整输出的字节数，下次请求可作为 offset
+	Truncated    bool        `json:"output_truncated,omitempty"`
+}
+
+// 获取任务快照和变化通知
+func (j *Job) Snapshot(offset int) (*JobSnapshot, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if offset < 0 || offset > len(j.Output) {
+		offset = len(j.Output)
+	}
+	return &JobSnapshot{
+		ID:           j.ID,
+		Type:         j.Type,
+		State:        j.State,
+		CreatedAt:    j.CreatedAt,
+		StartedAt:    j.StartedAt,
+		EndedAt:      j.EndedAt,
+		ExitCode:     j.ExitCode,
+		Error:        j.Error,
+		Result:       j.Result,
+		Output:       j.Output[offset:],
+		OutputOffset: offset,
+		OutputSize:   len(j.Output),
+		Truncated:    j.Truncated,
+	}, j.changed
+}
+
+// 任务是否已结束
+func (j *Job) Finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return isFinalJobState(j.State)
+}
+
+// 追加输出
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.Truncated {
+		return len(p), nil
+	}
+	data := p
+	if len(j.Output)+len(data) > maxJobOutput {
+		data = data[:maxJobOutput-len(j.Output)]
+		j.Truncated = true
+	}
+	j.Output += string(data)
+	j.notify()
+	return len(p), nil
+}
+
+// 通知订阅者，调用时需持有锁
+func (j *Job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func isFinalJobState(state string) bool {
+	return state == JobSucceeded || state == JobFailed || state == JobCancelled
+}
+
+// 后台任务管理，运行中的任务保存在内存中，结束的任务同时保存到磁盘，最多保留 maxJobHistory 个
+type JobManager struct {
+	mu   sync.Mutex
+	dir  string
+	jobs map[string]*Job
+}
+
+// 加载磁盘上的任务记录，agent 退出时仍在运行的任务标记为失败
+func NewJobManager() (*JobManager, error) {
+	m := &JobManager{
+		dir:  jobHistoryDir,
+		jobs: make(map[string]*Job),
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil || job.ID == "" {
+			continue
+		}
+		job.changed = make(chan struct{})
+		if !isFinalJobState(job.State) {
+			now := time.Now()
+			job.State = JobFailed
+			job.EndedAt = &now
+			job.Error = "agent restarted while the job was running"
+			m.save(job)
+		}
+		m.jobs[job.ID] = job
+	}
+	m.prune()
+	return m, nil
+}
+
+// 创建并在后台运行任务
+func (m *JobManager) Start(jobType string, fn JobFunc) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:        newJobID(),
+		Type:      jobType,
+		State:     JobPending,
+		CreatedAt: time.Now(),
+		cancel:    cancel,
+		changed:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	go m.run(ctx, job, fn)
+	return job
+}
+
+func (m *JobManager) run(ctx context.Context, job *Job, fn JobFunc) {
+	defer job.cancel()
+
+	job.mu.Lock()
+	now := time.Now()
+	job.State = JobRunning
+	job.StartedAt = &now
+	job.notify()
+	job.mu.Unlock()
+	m.save(job)
+
+	result, err := fn(ctx, job)
+
+	job.mu.Lock()
+	end := time.Now()
+	job.EndedAt = &end
+	job.Result = result
+	exitCode := 0
+	switch {
+	case err == nil:
+		job.State = JobSucceeded
+	case ctx.Err() != nil:
+		job.State = JobCancelled
+		job.Error = "job cancelled"
+		exitCode = -1
+	default:
+		job.State = JobFailed
+		job.Error = err.Error()
+		exitCode = 1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	job.ExitCode = &exitCode
+	job.notify()
+	job.mu.Unlock()
+
+	m.save(job)
+	m.mu.Lock()
+	m.prune()
+	m.mu.Unlock()
+}
+
+// 获取任务
+func (m *JobManager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// 按创建时间倒序列出任务，不包含输出
+func (m *JobManager) List() []*JobSnapshot {
+	m.mu.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.mu.Unlock()
+
+	snapshots := make([]*JobSnapshot, 0, len(jobs))
+	for _, job := range jobs {
+		snapshot, _ := job.Snapshot(-1)
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots
+}
+
+// 取消任务
+func (m *JobManager) Cancel(id string) error {
+	job, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	job.mu.Lock()
+	cancel := job.cancel
+	finished := isFinalJobState(job.State)
+	job.mu.Unlock()
+	if finished || cancel == nil {
+		return ErrJobFinished
+	}
+
+	cancel()
+	job.Write([]byte("\n[cancel requested]\n"))
+	return nil
+}
+
+// 删除超出数量的已结束任务，调用时需持有锁
+func (m *JobManager) prune() {
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxJobHistory {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CreatedAt.After(finished[j].CreatedAt)
+	})
+	for _, job := range finished[maxJobHistory:] {
+		delete(m.jobs, job.ID)
+		os.Remove(filepath.Join(m.dir, job.ID+".json"))
+	}
+}
+
+// 写入文件，先写临时文件再重命名
+func (m *JobManager) save(job *Job) {
+	job.mu.Lock()
+	data, err := json.MarshalIndent(job, "", "    ")
+	job.mu.Unlock()
+	if err != nil {
+		log.Printf("保存任务 %s 失败: %v", job.ID, err)
+		return
+	}
+	path := filepath.Join(m.dir, job.ID+".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		log.Printf("保存任务 %s 失败: %v", job.ID, err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("保存任务 %s 失败: %v", job.ID, err)
+	}
+}
+
+// 时间前缀加随机数，按字典序大致等于创建顺序
+func newJobID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%x%s", time.Now().UnixMilli(), hex.EncodeToString(b))
+}
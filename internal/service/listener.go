@@ -0,0 +1,235 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// hysteria 未配置 listen 时的默认监听地址
+const defaultListen = ":443"
+
+// 监听端口的占用状态
+const (
+	PortBoundByHysteria = "bound_by_hysteria"
+	PortBoundByOther    = "bound_by_other"
+	PortNotBound        = "not_bound"
+)
+
+var procNetUDPFiles = []string{"/proc/net/udp", "/proc/net/udp6"}
+
+// 系统中的一个 UDP 套接字
+type UDPSocket struct {
+	Address string `json:"address"` // 本地地址，如 "0.0.0.0:443"、"[::]:443"
+	Inode   uint64 `json:"inode"`
+	PID     int32  `json:"pid,omitempty"`     // 持有套接字的进程，无法确定时为 0
+	Process string `json:"process,omitempty"` // 进程名
+}
+
+// 监听端口检查结果
+type ListenerCheck struct {
+	Listen    string      `json:"listen"` // 配置中的监听地址
+	Port      int         `json:"port"`
+	State     string      `json:"state"`
+	Addresses []string    `json:"addresses,omitempty"` // hysteria 绑定的地址
+	Others    []UDPSocket `json:"others,omitempty"`    // 其他进程在该端口上的套接字
+	Error     string      `json:"error,omitempty"`
+}
+
+// 检查监听端口是否由 hysteria 主进程持有
+// 通过 /proc/net/udp 和 /proc/net/udp6 找到该端口上的套接字，再按 inode 与进程的文件描述符对应
+func (h *Hysteria2Service) CheckListener(listen string) *ListenerCheck {
+	check := &ListenerCheck{Listen: listen, State: PortNotBound}
+	if strings.TrimSpace(listen) == "" {
+		check.Listen = defaultListen
+	}
+
+	port, err := parseListenPort(check.Listen)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.Port = port
+
+	sockets, err := readUDPSockets(port)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	if len(sockets) == 0 {
+		return check
+	}
+
+	// hysteria 主进程持有的套接字
+	var owned map[uint64]bool
+	if unit, err := h.unitStatus(); err == nil && unit.MainPID != 0 {
+		owned = socketInodes(int32(unit.MainPID))
+	}
+
+	var others []*UDPSocket
+	for i := range sockets {
+		if owned[sockets[i].Inode] {
+			check.Addresses = append(check.Addresses, sockets[i].Address)
+		} else {
+			others = append(others, &sockets[i])
+		}
+	}
+	if len(others) > 0 {
+		findSocketOwners(others)
+		for _, socket := range others {
+			check.Others = append(check.Others, *socket)
+		}
+	}
+
+	switch {
+	case len(check.Addresses) > 0:
+		check.State = PortBoundByHysteria
+	case len(check.Others) > 0:
+		check.State = PortBoundByOther
+	}
+	return check
+}
+
+// 解析监听地址中的端口，支持 ":443"、"0.0.0.0:443"、"[::]:443" 等形式
+func parseListenPort(listen string) (int, error) {
+	_, portStr, err := net.SplitHostPort(strings.TrimSpace(listen))
+	if err != nil {
+		return 0, fmt.Errorf("invalid listen address %q: %v", listen, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid listen port %q", portStr)
+	}
+	return port, nil
+}
+
+// 读取本地端口为 port 且未连接的 UDP 套接字
+func readUDPSockets(port int) ([]UDPSocket, error) {
+	var sockets []UDPSocket
+	for _, path := range procNetUDPFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			// 内核未启用 IPv6 时没有 udp6
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Scan() // 跳过表头
+		for scanner.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			localIP, localPort, err := parseProcAddress(fields[1])
+			if err != nil || localPort != port {
+				continue
+			}
+			if _, remotePort, err := parseProcAddress(fields[2]); err != nil || remotePort != 0 {
+				continue
+			}
+			inode, err := strconv.ParseUint(fields[9], 10, 64)
+			if err != nil {
+				continue
+			}
+			sockets = append(sockets, UDPSocket{
+				Address: net.JoinHostPort(localIP.String(), strconv.Itoa(localPort)),
+				Inode:   inode,
+			})
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sockets, nil
+}
+
+// 解析 /proc/net/udp 中的地址，如 "0100007F:01BB"
+// IP 按 32 位字分组，每组为主机字节序
+func parseProcAddress(s string) (net.IP, int, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("malformed address %q", s)
+	}
+	raw, err := hex.DecodeString(ipHex)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("malformed address %q", s)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("malformed address %q", s)
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+	return ip, int(port), nil
+}
+
+// 进程持有的套接字 inode
+func socketInodes(pid int32) map[uint64]bool {
+	fdDir := filepath.Join("/proc", strconv.Itoa(int(pid)), "fd")
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+
+	inodes := make(map[uint64]bool)
+	for _, entry := range entries {
+		link, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		// 形如 "socket:[12345]"
+		if rest, ok := strings.CutPrefix(link, "socket:["); ok {
+			if inode, err := strconv.ParseUint(strings.TrimSuffix(rest, "]"), 10, 64); err == nil {
+				inodes[inode] = true
+			}
+		}
+	}
+	return inodes
+}
+
+// 遍历所有进程，找到持有这些套接字的进程
+func findSocketOwners(sockets []*UDPSocket) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+
+	remaining := len(sockets)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		inodes := socketInodes(int32(pid))
+		if len(inodes) == 0 {
+			continue
+		}
+		for _, socket := range sockets {
+			if socket.PID == 0 && inodes[socket.Inode] {
+				socket.PID = int32(pid)
+				if comm, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm")); err == nil {
+					socket.Process = strings.TrimSpace(string(comm))
+				}
+				remaining--
+			}
+		}
+		if remaining == 0 {
+			return
+		}
+	}
+}
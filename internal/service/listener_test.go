@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// /proc/net/udp 中的 IP 按 32 位字以主机字节序输出，小端和大端机器上的同一地址写法不同
+func TestParseProcAddress(t *testing.T) {
+	littleEndian := binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+	tests := []struct {
+		little, big string
+		ip          string
+		port        int
+	}{
+		{"0100007F:01BB", "7F000001:01BB", "127.0.0.1", 443},
+		{"00000000:0035", "00000000:0035", "0.0.0.0", 53},
+		{"0A7100CB:4E20", "CB00710A:4E20", "203.0.113.10", 20000},
+		{"00000000000000000000000001000000:01BB", "00000000000000000000000000000001:01BB", "::1", 443},
+		{"B80D0120000000000000000001000000:FFFF", "20010DB8000000000000000000000001:FFFF", "2001:db8::1", 65535},
+		{"0000000000000000FFFF00000100007F:1F90", "00000000000000000000FFFF7F000001:1F90", "127.0.0.1", 8080},
+	}
+	for _, tt := range tests {
+		s := tt.big
+		if littleEndian {
+			s = tt.little
+		}
+		ip, port, err := parseProcAddress(s)
+		if err != nil {
+			t.Errorf("parseProcAddress(%q): %v", s, err)
+			continue
+		}
+		if !ip.Equal(net.ParseIP(tt.ip)) || port != tt.port {
+			t.Errorf("parseProcAddress(%q) = %s, %d; want %s, %d", s, ip, port, tt.ip, tt.port)
+		}
+	}
+}
+
+func TestParseProcAddressInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"0100007F",
+		"0100007F:",
+		"0100007F:XYZ",
+		"0100007F:10000",
+		"01007F:01BB",
+		"ZZ00007F:01BB",
+	} {
+		if _, _, err := parseProcAddress(s); err == nil {
+			t.Errorf("parseProcAddress(%q) succeeded, want error", s)
+		}
+	}
+}
+
+// 在本机绑定 UDP 端口，确认能从 /proc/net/udp 中读到
+func TestReadUDPSockets(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	sockets, err := readUDPSockets(port)
+	if err != nil {
+		t.Skipf("cannot read /proc/net/udp: %v", err)
+	}
+	want := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for _, socket := range sockets {
+		if socket.Address == want && socket.Inode != 0 {
+			return
+		}
+	}
+	t.Errorf("readUDPSockets(%d) = %+v, want a socket at %s", port, sockets, want)
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 等待操作锁的最长时间
+const MaxOperationWait = 5 * time.Minute
+
+var ErrOperationInProgress = fmt.Errorf("another operation is in progress")
+
+// 正在执行的修改操作
+type Operation struct {
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"started_at"`
+	JobID     string    `json:"job_id,omitempty"` // 在后台任务中执行时的任务 ID
+}
+
+// 操作锁被占用时返回的错误
+type OperationBusyError struct {
+	Current Operation
+}
+
+func (e *OperationBusyError) Error() string {
+	msg := fmt.Sprintf("%s: %s since %s", ErrOperationInProgress, e.Current.Name, e.Current.StartedAt.Format(time.RFC3339))
+	if e.Current.JobID != "" {
+		msg += fmt.Sprintf(" (job %s)", e.Current.JobID)
+	}
+	return msg
+}
+
+func (e *OperationBusyError) Unwrap() error {
+	return ErrOperationInProgress
+}
+
+// 全局操作锁，所有修改服务、配置或二进制文件的操作都需要先获取，同一时间只允许一个操作
+// 锁在各个服务的修改方法内部获取，后台任务和 HTTP 请求使用同一把锁
+// Hysteria2Service 没有状态，锁放在包级别，保证所有实例共享
+type operationLock struct {
+	sem     chan struct{}
+	mu      sync.Mutex
+	current *Operation
+}
+
+var operations = &operationLock{sem: make(chan struct{}, 1)}
+
+type (
+	operationLeaseKey struct{}
+	operationWaitKey  struct{}
+)
+
+// 持有的操作锁，嵌套在已持有锁的操作中获取时 lock 为空，释放时不做任何事
+type OperationLease struct {
+	lock *operationLock
+	op   *Operation
+	once sync.Once
+}
+
+// 记录执行操作的后台任务，任务已结束并释放锁时忽略
+func (l *OperationLease) SetJob(id string) {
+	if l.lock == nil {
+		return
+	}
+	l.lock.mu.Lock()
+	defer l.lock.mu.Unlock()
+	if l.lock.current == l.op {
+		l.op.JobID = id
+	}
+}
+
+// 释放操作锁，可以重复调用
+func (l *OperationLease) Release() {
+	if l.lock == nil {
+		return
+	}
+	l.once.Do(func() {
+		l.lock.mu.Lock()
+		if l.lock.current == l.op {
+			l.lock.current = nil
+		}
+		l.lock.mu.Unlock()
+		<-l.lock.sem
+	})
+}
+
+// 返回指定等待时间的上下文，锁被占用时最多等待 wait，未指定时立即返回 OperationBusyError
+func WithOperationWait(ctx context.Context, wait time.Duration) context.Context {
+	return context.WithValue(ctx, operationWaitKey{}, wait)
+}
+
+// 把已持有的操作锁放入 ctx，用于在后台任务中继续持有请求时获取的锁
+func WithOperation(ctx context.Context, lease *OperationLease) context.Context {
+	return context.WithValue(ctx, operationLeaseKey{}, lease)
+}
+
+// 获取操作锁，返回持有锁的上下文，使用该上下文调用的修改操作不再重复获取
+// ctx 已持有锁时直接返回空租约，因此修改方法可以互相调用
+func BeginOperation(ctx context.Context, name string) (*OperationLease, context.Context, error) {
+	if _, ok := ctx.Value(operationLeaseKey{}).(*OperationLease); ok {
+		return &OperationLease{}, ctx, nil
+	}
+
+	wait, _ := ctx.Value(operationWaitKey{}).(time.Duration)
+	if wait > MaxOperationWait {
+		wait = MaxOperationWait
+	}
+
+	select {
+	case operations.sem <- struct{}{}:
+	default:
+		if wait <= 0 {
+			return nil, nil, operations.busyError()
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case operations.sem <- struct{}{}:
+		case <-timer.C:
+			return nil, nil, operations.busyError()
+		}
+	}
+
+	op := &Operation{Name: name, StartedAt: time.Now()}
+	operations.mu.Lock()
+	operations.current = op
+	operations.mu.Unlock()
+	lease := &OperationLease{lock: operations, op: op}
+	return lease, WithOperation(ctx, lease), nil
+}
+
+// 当前正在执行的操作，没有时返回 nil
+func (h *Hysteria2Service) CurrentOperation() *Operation {
+	operations.mu.Lock()
+	defer operations.mu.Unlock()
+	if operations.current == nil {
+		return nil
+	}
+	op := *operations.current
+	return &op
+}
+
+func (l *operationLock) busyError() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := &OperationBusyError{}
+	if l.current != nil {
+		err.Current = *l.current
+	}
+	return err
+}
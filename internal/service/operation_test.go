@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustBeginOperation(t *testing.T, ctx context.Context, name string) (*OperationLease, context.Context) {
+	t.Helper()
+	lease, ctx, err := BeginOperation(ctx, name)
+	if err != nil {
+		t.Fatalf("BeginOperation(%q) error: %v", name, err)
+	}
+	return lease, ctx
+}
+
+func assertOperationBusy(t *testing.T, err error, want string) {
+	t.Helper()
+	var busyErr *OperationBusyError
+	if !errors.As(err, &busyErr) {
+		t.Fatalf("error = %v, want OperationBusyError", err)
+	}
+	if !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("error %v does not wrap ErrOperationInProgress", err)
+	}
+	if busyErr.Current.Name != want {
+		t.Errorf("busy operation = %q, want %q", busyErr.Current.Name, want)
+	}
+}
+
+func TestBeginOperationBusy(t *testing.T) {
+	lease, _ := mustBeginOperation(t, context.Background(), "first")
+
+	_, _, err := BeginOperation(context.Background(), "second")
+	assertOperationBusy(t, err, "first")
+
+	lease.Release()
+	lease, _ = mustBeginOperation(t, context.Background(), "second")
+	lease.Release()
+}
+
+func TestBeginOperationReentrant(t *testing.T) {
+	outer, ctx := mustBeginOperation(t, context.Background(), "outer")
+	defer outer.Release()
+
+	// 使用持有锁的上下文再次获取时不等待，也不替换当前操作
+	inner, innerCtx := mustBeginOperation(t, ctx, "inner")
+	if innerCtx != ctx {
+		t.Errorf("nested BeginOperation returned a new context")
+	}
+	inner.SetJob("ignored")
+	inner.Release()
+
+	// 内层释放不能释放外层持有的锁
+	_, _, err := BeginOperation(context.Background(), "other")
+	assertOperationBusy(t, err, "outer")
+	var busyErr *OperationBusyError
+	if errors.As(err, &busyErr) && busyErr.Current.JobID != "" {
+		t.Errorf("nested lease set job %q on the outer operation", busyErr.Current.JobID)
+	}
+}
+
+func TestBeginOperationWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		wait      time.Duration
+		releaseIn time.Duration // 持有者在多久后释放，0 表示测试期间不释放
+		wantBusy  bool
+	}{
+		{name: "no wait", wait: 0, releaseIn: 0, wantBusy: true},
+		{name: "negative wait", wait: -time.Second, releaseIn: 0, wantBusy: true},
+		{name: "released while waiting", wait: 2 * time.Second, releaseIn: 20 * time.Millisecond, wantBusy: false},
+		{name: "wait times out", wait: 30 * time.Millisecond, releaseIn: 0, wantBusy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holder, _ := mustBeginOperation(t, context.Background(), "holder")
+			defer holder.Release()
+			if tt.releaseIn > 0 {
+				timer := time.AfterFunc(tt.releaseIn, holder.Release)
+				defer timer.Stop()
+			}
+
+			start := time.Now()
+			lease, _, err := BeginOperation(WithOperationWait(context.Background(), tt.wait), "waiter")
+			elapsed := time.Since(start)
+
+			if tt.wantBusy {
+				assertOperationBusy(t, err, "holder")
+				if tt.wait > 0 && elapsed < tt.wait {
+					t.Errorf("gave up after %v, want at least %v", elapsed, tt.wait)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BeginOperation error: %v", err)
+			}
+			lease.Release()
+		})
+	}
+}
+
+func TestOperationLeaseHandOff(t *testing.T) {
+	// 模拟 HTTP 请求获取锁后交给后台任务，任务结束时释放
+	lease, _ := mustBeginOperation(t, context.Background(), "install")
+	lease.SetJob("job-1")
+
+	_, _, err := BeginOperation(context.Background(), "update")
+	assertOperationBusy(t, err, "install")
+	var busyErr *OperationBusyError
+	if errors.As(err, &busyErr) && busyErr.Current.JobID != "job-1" {
+		t.Errorf("busy job = %q, want %q", busyErr.Current.JobID, "job-1")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer lease.Release()
+		ctx := WithOperation(context.Background(), lease)
+		nested, _, err := BeginOperation(ctx, "restart")
+		if err == nil {
+			nested.Release()
+		}
+		done <- err
+	}()
+	if err := <-done; err != nil {
+		t.Fatalf("BeginOperation inside job error: %v", err)
+	}
+
+	next, _ := mustBeginOperation(t, WithOperationWait(context.Background(), time.Second), "update")
+	defer next.Release()
+
+	// 已释放的租约再次释放或记录任务时不能影响新的持有者
+	lease.Release()
+	lease.SetJob("job-1")
+	_, _, err = BeginOperation(context.Background(), "other")
+	assertOperationBusy(t, err, "update")
+	if errors.As(err, &busyErr) && busyErr.Current.JobID != "" {
+		t.Errorf("stale lease set job %q on the new operation", busyErr.Current.JobID)
+	}
+}
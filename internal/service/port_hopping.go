@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	portHoppingPath    = "/etc/hy2agent/port_hopping.json"
+	portHoppingTable   = "hy2agent"
+	portHoppingChain   = "porthop"
+	portHoppingComment = "hy2agent-porthop"
+
+	PortHoppingNftables = "nftables"
+	PortHoppingIptables = "iptables"
+)
+
+var (
+	ErrInvalidPortHopping = fmt.Errorf("invalid port hopping config")
+	ErrNoFirewallBackend  = fmt.Errorf("neither nft nor iptables is available")
+
+	interfacePattern = regexp.MustCompile(`^[a-zA-Z0-9_.@-]{1,15}$`)
+)
+
+// 端口跳跃设置
+type PortHoppingConfig struct {
+	Enabled   bool   `json:"enabled"`
+	StartPort int    `json:"start_port,omitempty"`
+	EndPort   int    `json:"end_port,omitempty"`
+	Interface string `json:"interface,omitempty"` // 仅转发从该网卡进入的流量，为空时不限制
+}
+
+// 端口跳跃状态
+type PortHoppingStatus struct {
+	PortHoppingConfig
+	ListenPort   string   `json:"listen_port,omitempty"`
+	Backend      string   `json:"backend,omitempty"`
+	RulesPresent bool     `json:"rules_present"` // 转发规则是否存在且指向当前监听端口
+	Rules        []string `json:"rules,omitempty"`
+}
+
+// 管理端口跳跃的 UDP 转发规则，优先使用 nftables，不可用时使用 iptables 和 ip6tables
+// 设置保存在 /etc/hy2agent/port_hopping.json，agent 启动时重新下发规则
+type PortHoppingService struct {
+	hy2Service *Hysteria2Service
+	path       string
+}
+
+func NewPortHoppingService() *PortHoppingService {
+	return &PortHoppingService{
+		hy2Service: NewHysteria2Service(),
+		path:       portHoppingPath,
+	}
+}
+
+// 读取端口跳跃设置
+func (s *PortHoppingService) GetConfig() (*PortHoppingConfig, error) {
+	cfg := &PortHoppingConfig{}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// 获取端口跳跃状态和当前的转发规则
+func (s *PortHoppingService) GetStatus() (*PortHoppingStatus, error) {
+	cfg, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	status := &PortHoppingStatus{
+		PortHoppingConfig: *cfg,
+		ListenPort:        s.listenPort(),
+		Backend:           firewallBackend(),
+	}
+
+	switch status.Backend {
+	case PortHoppingNftables:
+		status.Rules = nftListRules()
+	case PortHoppingIptables:
+		for _, bin := range iptablesBinaries() {
+			for _, rule := range iptablesListRules(bin) {
+				status.Rules = append(status.Rules, bin+" "+rule)
+			}
+		}
+	}
+	if cfg.Enabled {
+		status.RulesPresent = s.rulesPresent(cfg, status.ListenPort, status.Backend, status.Rules)
+	}
+	return status, nil
+}
+
+// 修改端口跳跃设置并下发规则，下发失败时不保存设置
+func (s *PortHoppingService) SetConfig(ctx context.Context, cfg *PortHoppingConfig) (*PortHoppingStatus, error) {
+	if cfg.Enabled {
+		if err := validatePortHopping(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	lease, _, err := BeginOperation(ctx, "update_port_hopping")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	if cfg.Enabled {
+		if err := s.install(cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := removePortHoppingRules(); err != nil {
+			return nil, err
+		}
+		cfg = &PortHoppingConfig{}
+	}
+
+	if err := s.save(cfg); err != nil {
+		return nil, err
+	}
+	return s.GetStatus()
+}
+
+// 规则缺失或未指向当前监听端口时按保存的设置重新下发，用于 agent 启动和配置变更后
+func (s *PortHoppingService) Restore(ctx context.Context) error {
+	lease, _, err := BeginOperation(ctx, "restore_port_hopping")
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	status, err := s.GetStatus()
+	if err != nil {
+		return err
+	}
+	if !status.Enabled || status.RulesPresent {
+		return nil
+	}
+	return s.install(&status.PortHoppingConfig)
+}
+
+// 替换为新的转发规则
+func (s *PortHoppingService) install(cfg *PortHoppingConfig) error {
+	backend := firewallBackend()
+	if backend == "" {
+		return ErrNoFirewallBackend
+	}
+	port := s.listenPort()
+	if _, err := strconv.Atoi(port); err != nil {
+		return fmt.Errorf("%w: listen port %q is not a single port", ErrInvalidPortHopping, port)
+	}
+
+	// 先清除旧规则，避免切换后端或范围后残留
+	if err := removePortHoppingRules(); err != nil {
+		return err
+	}
+	if backend == PortHoppingNftables {
+		return nftInstall(cfg, port)
+	}
+	return iptablesInstall(cfg, port)
+}
+
+// 规则是否齐全且指向当前监听端口，监听端口未知时视为规则缺失
+// 按空白拆分后比较完整的字段，避免 443 匹配到 4433 这类前缀相同的端口
+func (s *PortHoppingService) rulesPresent(cfg *PortHoppingConfig, port, backend string, rules []string) bool {
+	if port == "" {
+		return false
+	}
+	var dport, target []string
+	var want int
+	switch backend {
+	case PortHoppingNftables:
+		dport = []string{"udp", "dport", fmt.Sprintf("%d-%d", cfg.StartPort, cfg.EndPort)}
+		target = []string{"redirect", "to", ":" + port}
+		want = 1 // inet 表同时处理 IPv4 和 IPv6
+	case PortHoppingIptables:
+		dport = []string{"--dport", fmt.Sprintf("%d:%d", cfg.StartPort, cfg.EndPort)}
+		target = []string{"--to-ports", port}
+		want = len(iptablesBinaries())
+	default:
+		return false
+	}
+
+	found := 0
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+		if containsFields(fields, dport) && containsFields(fields, target) {
+			found++
+		}
+	}
+	return found >= want
+}
+
+// fields 中是否有连续的一段与 want 完全相同
+func containsFields(fields, want []string) bool {
+	for i := 0; i+len(want) <= len(fields); i++ {
+		match := true
+		for j := range want {
+			if fields[i+j] != want[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// 当前配置中的监听端口，未配置时为 hysteria 默认的 443
+func (s *PortHoppingService) listenPort() string {
+	cfg, err := s.hy2Service.GetParsedConfig()
+	if err != nil {
+		return ""
+	}
+	if port := cfg.ListenPort(); port != "" {
+		return port
+	}
+	return "443"
+}
+
+// 写入文件，先写临时文件再重命名
+func (s *PortHoppingService) save(cfg *PortHoppingConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func validatePortHopping(cfg *PortHoppingConfig) error {
+	if cfg.StartPort < 1 || cfg.EndPort > 65535 || cfg.StartPort >= cfg.EndPort {
+		return fmt.Errorf("%w: port range must be within 1-65535 and start_port < end_port", ErrInvalidPortHopping)
+	}
+	if cfg.Interface != "" && !interfacePattern.MatchString(cfg.Interface) {
+		return fmt.Errorf("%w: invalid interface %q", ErrInvalidPortHopping, cfg.Interface)
+	}
+	return nil
+}
+
+// 可用的防火墙后端
+func firewallBackend() string {
+	if _, err := exec.LookPath("nft"); err == nil {
+		return PortHoppingNftables
+	}
+	if len(iptablesBinaries()) > 0 {
+		return PortHoppingIptables
+	}
+	return ""
+}
+
+// 可用的 iptables 命令，分别处理 IPv4 和 IPv6
+func iptablesBinaries() []string {
+	var bins []string
+	for _, bin := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			bins = append(bins, bin)
+		}
+	}
+	return bins
+}
+
+// 清除所有后端中由 agent 创建的规则
+func removePortHoppingRules() error {
+	if _, err := exec.LookPath("nft"); err == nil {
+		if nftTableExists() {
+			output, err := exec.Command("nft", "delete", "table", "inet", portHoppingTable).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("failed to delete nftables table: %s", strings.TrimSpace(string(output)))
+			}
+		}
+	}
+	for _, bin := range iptablesBinaries() {
+		for _, rule := range iptablesListRules(bin) {
+			args := append([]string{"-t", "nat", "-D"}, strings.Fields(rule)[1:]...)
+			output, err := exec.Command(bin, args...).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("failed to delete %s rule: %s", bin, strings.TrimSpace(string(output)))
+			}
+		}
+	}
+	return nil
+}
+
+func nftTableExists() bool {
+	return exec.Command("nft", "list", "table", "inet", portHoppingTable).Run() == nil
+}
+
+// 使用独立的 inet 表，不影响系统中的其他规则
+func nftInstall(cfg *PortHoppingConfig, port string) error {
+	match := ""
+	if cfg.Interface != "" {
+		match = fmt.Sprintf("iifname %q ", cfg.Interface)
+	}
+	script := fmt.Sprintf(`table inet %s {
+	chain %s {
+		type nat hook prerouting priority -100; policy accept;
+		%sudp dport %d-%d redirect to :%s
+	}
+}
+`, portHoppingTable, portHoppingChain, match, cfg.StartPort, cfg.EndPort, port)
+
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to install nftables rules: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func nftListRules() []string {
+	output, err := exec.Command("nft", "list", "chain", "inet", portHoppingTable, portHoppingChain).Output()
+	if err != nil {
+		return nil
+	}
+	var rules []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "dport") {
+			rules = append(rules, line)
+		}
+	}
+	return rules
+}
+
+// 规则通过注释标记，删除时只处理带标记的规则
+func iptablesInstall(cfg *PortHoppingConfig, port string) error {
+	args := []string{"-t", "nat", "-A", "PREROUTING"}
+	if cfg.Interface != "" {
+		args = append(args, "-i", cfg.Interface)
+	}
+	args = append(args,
+		"-p", "udp", "--dport", fmt.Sprintf("%d:%d", cfg.StartPort, cfg.EndPort),
+		"-m", "comment", "--comment", portHoppingComment,
+		"-j", "REDIRECT", "--to-ports", port,
+	)
+	for _, bin := range iptablesBinaries() {
+		if output, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+			removePortHoppingRules()
+			return fmt.Errorf("failed to install %s rules: %s", bin, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func iptablesListRules(bin string) []string {
+	output, err := exec.Command(bin, "-t", "nat", "-S", "PREROUTING").Output()
+	if err != nil {
+		return nil
+	}
+	var rules []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.Contains(line, portHoppingComment) {
+			rules = append(rules, strings.TrimSpace(line))
+		}
+	}
+	return rules
+}
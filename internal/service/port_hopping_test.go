@@ -0,0 +1,92 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRulesPresentNftables(t *testing.T) {
+	cfg := &PortHoppingConfig{Enabled: true, StartPort: 20000, EndPort: 30000}
+	s := &PortHoppingService{}
+
+	tests := []struct {
+		name  string
+		port  string
+		rules []string
+		want  bool
+	}{
+		{
+			name:  "matching rule",
+			port:  "443",
+			rules: []string{"udp dport 20000-30000 redirect to :443"},
+			want:  true,
+		},
+		{
+			name:  "matching rule on interface",
+			port:  "443",
+			rules: []string{`iifname "eth0" udp dport 20000-30000 redirect to :443`},
+			want:  true,
+		},
+		{
+			name:  "redirects to a longer port",
+			port:  "443",
+			rules: []string{"udp dport 20000-30000 redirect to :4433"},
+			want:  false,
+		},
+		{
+			name:  "range is a prefix of the rule's range",
+			port:  "443",
+			rules: []string{"udp dport 20000-300000 redirect to :443"},
+			want:  false,
+		},
+		{
+			name:  "different range",
+			port:  "443",
+			rules: []string{"udp dport 10000-30000 redirect to :443"},
+			want:  false,
+		},
+		{
+			name:  "unknown listen port",
+			port:  "",
+			rules: []string{"udp dport 20000-30000 redirect to :443"},
+			want:  false,
+		},
+		{
+			name:  "no rules",
+			port:  "443",
+			rules: nil,
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.rulesPresent(cfg, tt.port, PortHoppingNftables, tt.rules); got != tt.want {
+				t.Errorf("rulesPresent(%q, %q) = %v, want %v", tt.port, tt.rules, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainsFields(t *testing.T) {
+	rule := `-A PREROUTING -p udp -m udp --dport 20000:30000 -m comment --comment hy2agent-porthop -j REDIRECT --to-ports 443`
+
+	tests := []struct {
+		want  []string
+		found bool
+	}{
+		{[]string{"--dport", "20000:30000"}, true},
+		{[]string{"--to-ports", "443"}, true},
+		{[]string{"--to-ports", "44"}, false},
+		{[]string{"--dport", "20000:3000"}, false},
+		{[]string{"--dport", "30000"}, false},
+		{[]string{"443", "--to-ports"}, false},
+	}
+
+	fields := strings.Fields(rule)
+	for _, tt := range tests {
+		if got := containsFields(fields, tt.want); got != tt.found {
+			t.Errorf("containsFields(%q) = %v, want %v", tt.want, got, tt.found)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apernet/hysteria/core/v2/client"
+	coreErrs "github.com/apernet/hysteria/core/v2/errors"
+)
+
+const DefaultProbeTimeout = 10 * time.Second
+
+// 探测失败的阶段
+const (
+	ProbeStageConfig  = "config"  // 无法从配置生成客户端参数
+	ProbeStageConnect = "connect" // QUIC 连接失败或超时，常见于端口不通或混淆密码不一致
+	ProbeStageTLS     = "tls"     // 证书校验失败
+	ProbeStageAuth    = "auth"    // 认证被拒绝
+	ProbeStageRelay   = "relay"   // 经代理请求测试地址失败
+)
+
+// 探测参数
+type ProbeOptions struct {
+	User    string        // 使用的用户，为空时使用 agent 配置中的 probe_user 或第一个可用用户
+	Auth    string        // 直接指定认证字符串，优先于 User，用于 agent 不管理的认证方式
+	Target  string        // 可选，经代理请求的 http(s) 地址
+	Timeout time.Duration // 整个探测的超时时间，默认 10 秒
+}
+
+// 探测结果
+type ProbeResult struct {
+	Success     bool    `json:"success"`
+	Stage       string  `json:"stage,omitempty"` // 失败的阶段
+	Error       string  `json:"error,omitempty"`
+	Server      string  `json:"server,omitempty"` // 连接的地址
+	SNI         string  `json:"sni,omitempty"`
+	User        string  `json:"user,omitempty"`
+	HandshakeMS float64 `json:"handshake_ms,omitempty"` // QUIC、TLS 握手和认证的总耗时
+	UDPEnabled  bool    `json:"udp_enabled"`            // 服务端是否允许 UDP 转发
+	Target      string  `json:"target,omitempty"`
+	RelayStatus int     `json:"relay_status,omitempty"` // 测试地址返回的 HTTP 状态码
+	RelayMS     float64 `json:"relay_ms,omitempty"`
+	CheckTime   string  `json:"check_time"`
+}
+
+// 最近一次探测的结果，健康检查中返回
+var lastProbe struct {
+	sync.Mutex
+	result *ProbeResult
+}
+
+// 用 Hysteria2 客户端连接本机的服务端，验证证书、混淆和认证配置是否可用
+type ProbeService struct {
+	hy2Service  *Hysteria2Service
+	userService *UserService
+	probeUser   string
+}
+
+func NewProbeService(userService *UserService, probeUser string) *ProbeService {
+	return &ProbeService{
+		hy2Service:  NewHysteria2Service(),
+		userService: userService,
+		probeUser:   probeUser,
+	}
+}
+
+// 最近一次探测的结果，尚未探测时返回 nil
+func LastProbeResult() *ProbeResult {
+	lastProbe.Lock()
+	defer lastProbe.Unlock()
+	if lastProbe.result == nil {
+		return nil
+	}
+	copied := *lastProbe.result
+	return &copied
+}
+
+// 执行一次探测，失败时在结果中记录失败的阶段
+func (s *ProbeService) Probe(opts ProbeOptions) *ProbeResult {
+	result := &ProbeResult{
+		Target:    opts.Target,
+		CheckTime: time.Now().Format(time.RFC3339),
+	}
+	if err := s.probe(opts, result); err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+
+	lastProbe.Lock()
+	lastProbe.result = result
+	lastProbe.Unlock()
+	copied := *result
+	return &copied
+}
+
+func (s *ProbeService) probe(opts ProbeOptions, result *ProbeResult) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultProbeTimeout
+	}
+	deadline := time.Now().Add(opts.Timeout)
+
+	result.Stage = ProbeStageConfig
+	if opts.Target != "" {
+		if u, err := url.Parse(opts.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("target must be an http or https url")
+		}
+	}
+	cfg, err := s.hy2Service.GetParsedConfig()
+	if err != nil {
+		return err
+	}
+	serverAddr, err := probeServerAddr(cfg.Listen)
+	if err != nil {
+		return err
+	}
+	result.Server = serverAddr.String()
+
+	auth := opts.Auth
+	if auth == "" {
+		if auth, result.User, err = s.credentials(cfg, opts.User); err != nil {
+			return err
+		}
+	}
+
+	clientConfig := &client.Config{
+		ServerAddr: serverAddr,
+		Auth:       auth,
+	}
+	verify := &certVerifyResult{}
+	if result.SNI, err = probeTLSConfig(cfg, serverAddr, &clientConfig.TLSConfig, verify); err != nil {
+		return err
+	}
+	if cfg.Obfs != nil && cfg.Obfs.Type == "salamander" {
+		if cfg.Obfs.Salamander == nil {
+			return fmt.Errorf("obfs.salamander.password is required")
+		}
+		clientConfig.ConnFactory = salamanderConnFactory(cfg.Obfs.Salamander.Password)
+	}
+
+	// 握手
+	result.Stage = ProbeStageConnect
+	start := time.Now()
+	hyClient, info, err := dialProbeClient(clientConfig, verify, time.Until(deadline))
+	if err != nil {
+		var authErr coreErrs.AuthError
+		var certErr *certVerifyError
+		switch {
+		case errors.As(err, &certErr):
+			result.Stage = ProbeStageTLS
+			return certErr.err
+		case errors.As(err, &authErr):
+			result.Stage = ProbeStageAuth
+			return fmt.Errorf("authentication rejected by server (status %d)", authErr.StatusCode)
+		}
+		return err
+	}
+	defer hyClient.Close()
+	result.HandshakeMS = milliseconds(time.Since(start))
+	result.UDPEnabled = info.UDPEnabled
+
+	// 经代理请求测试地址
+	if opts.Target != "" {
+		result.Stage = ProbeStageRelay
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return hyClient.TCP(addr)
+				},
+			},
+			Timeout: time.Until(deadline),
+		}
+		start := time.Now()
+		resp, err := httpClient.Get(opts.Target)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		result.RelayMS = milliseconds(time.Since(start))
+		result.RelayStatus = resp.StatusCode
+	}
+
+	result.Stage = ""
+	return nil
+}
+
+// 探测使用的认证字符串，password 认证直接使用配置中的密码，其他方式使用指定用户或第一个可用用户
+func (s *ProbeService) credentials(cfg *Hysteria2Config, username string) (string, string, error) {
+	if cfg.Auth == nil {
+		return "", "", fmt.Errorf("auth is not configured")
+	}
+	if cfg.Auth.Type == "password" {
+		return cfg.Auth.Password, "", nil
+	}
+
+	if username == "" {
+		username = s.probeUser
+	}
+	if username != "" {
+		user, err := s.userService.GetUser(username)
+		if err != nil {
+			return "", "", fmt.Errorf("probe user %s: %w", username, err)
+		}
+		return user.Username + ":" + user.Password, user.Username, nil
+	}
+
+	users, err := s.userService.ListUsers()
+	if err != nil {
+		if errors.Is(err, ErrAuthNotManaged) {
+			return "", "", fmt.Errorf("auth type %s is not managed by the agent, auth must be specified", cfg.Auth.Type)
+		}
+		return "", "", err
+	}
+	for _, user := range users {
+		if user.Usage == nil || user.Usage.Status == UserStatusActive {
+			return user.Username + ":" + user.Password, user.Username, nil
+		}
+	}
+	return "", "", fmt.Errorf("no active user available for probing")
+}
+
+// 本机的探测地址，监听所有地址时连接回环地址
+func probeServerAddr(listen string) (*net.UDPAddr, error) {
+	if strings.TrimSpace(listen) == "" {
+		listen = defaultListen
+	}
+	port, err := parseListenPort(listen)
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(strings.TrimSpace(listen))
+
+	ip := net.ParseIP(host)
+	switch {
+	case host == "":
+		ip = net.IPv4(127, 0, 0, 1)
+	case ip != nil && ip.IsUnspecified():
+		if ip.To4() != nil {
+			ip = net.IPv4(127, 0, 0, 1)
+		} else {
+			ip = net.IPv6loopback
+		}
+	case ip == nil:
+		addr, err := net.ResolveUDPAddr("udp", listen)
+		if err != nil {
+			return nil, err
+		}
+		return addr, nil
+	}
+	return &net.UDPAddr{IP: ip, Port: port}, nil
+}
+
+// 按服务端证书设置客户端的证书校验，与分享链接的规则一致：
+// ACME 证书使用第一个域名，自备证书使用证书中的第一个域名，自签名证书按指纹校验
+// 校验失败的原因记录在 verify 中，用于区分握手失败的阶段
+func probeTLSConfig(cfg *Hysteria2Config, server *net.UDPAddr, tlsConfig *client.TLSConfig, verify *certVerifyResult) (string, error) {
+	var sni, pin string
+	switch {
+	case cfg.ACME != nil && len(cfg.ACME.Domains) > 0:
+		sni = cfg.ACME.Domains[0]
+	case cfg.TLS != nil && cfg.TLS.Cert != "":
+		cert, err := loadCertificate(cfg.TLS.Cert)
+		if err != nil {
+			return "", err
+		}
+		if len(cert.DNSNames) > 0 {
+			sni = cert.DNSNames[0]
+		}
+		if isSelfSigned(cert) {
+			pin = certSHA256(cert)
+		}
+	default:
+		return "", fmt.Errorf("either tls or acme must be configured")
+	}
+
+	verifyName := sni
+	if verifyName == "" {
+		verifyName = server.IP.String()
+	}
+	tlsConfig.ServerName = sni
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		err := verifyServerCertificate(rawCerts, verifyName, pin)
+		verify.set(err)
+		return err
+	}
+	return sni, nil
+}
+
+// 证书校验的结果，在握手的 goroutine 中写入，读写需要加锁
+type certVerifyResult struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (r *certVerifyResult) set(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+func (r *certVerifyResult) get() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// 握手因证书校验失败而失败
+type certVerifyError struct {
+	err error
+}
+
+func (e *certVerifyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *certVerifyError) Unwrap() error {
+	return e.err
+}
+
+func verifyServerCertificate(rawCerts [][]byte, name, pin string) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server did not present a certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if pin != "" {
+		if certSHA256(certs[0]) != pin {
+			return fmt.Errorf("server certificate %s does not match the configured certificate %s", certSHA256(certs[0]), pin)
+		}
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{DNSName: name, Intermediates: intermediates}); err != nil {
+		return fmt.Errorf("server certificate verification failed: %v", err)
+	}
+	return nil
+}
+
+// 建立连接，超时后在后台等待握手结束并关闭连接
+// 握手结束后才读取证书校验的结果，校验失败时返回 certVerifyError；超时时不读取，握手可能仍在进行
+func dialProbeClient(config *client.Config, verify *certVerifyResult, timeout time.Duration) (client.Client, *client.HandshakeInfo, error) {
+	type dialResult struct {
+		client client.Client
+		info   *client.HandshakeInfo
+		err    error
+	}
+	done := make(chan dialResult, 1)
+	go func() {
+		c, info, err := client.NewClient(config)
+		if err != nil {
+			if verifyErr := verify.get(); verifyErr != nil {
+				err = &certVerifyError{verifyErr}
+			}
+		}
+		done <- dialResult{c, info, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.client, r.info, r.err
+	case <-timer.C:
+		go func() {
+			if r := <-done; r.client != nil {
+				r.client.Close()
+			}
+		}()
+		return nil, nil, fmt.Errorf("handshake timed out after %s", timeout.Round(time.Millisecond))
+	}
+}
+
+type salamanderConnFactory string
+
+func (password salamanderConnFactory) New(addr net.Addr) (net.PacketConn, error) {
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	obfsConn, err := newSalamanderConn(conn, string(password))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return obfsConn, nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gopsnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// 首次采样时计算 CPU 占用率的间隔
+const firstCPUSampleInterval = 200 * time.Millisecond
+
+// hysteria 进程的资源占用
+type ProcessMetrics struct {
+	PID        int32     `json:"pid"`
+	RSS        uint64    `json:"rss"`         // 常驻内存，字节
+	CPUPercent float64   `json:"cpu_percent"` // 距上次采样期间的 CPU 占用率，单核满载为 100
+	Threads    int32     `json:"threads"`
+	OpenFDs    int32     `json:"open_fds"`
+	MaxFDs     uint64    `json:"max_fds"`     // 文件描述符数量的软限制 (RLIMIT_NOFILE)
+	UDPSockets int       `json:"udp_sockets"` // 进程持有的 UDP 套接字数量
+	StartTime  time.Time `json:"start_time"`
+	Uptime     int64     `json:"uptime"`   // 进程运行时间，秒
+	Restarts   uint32    `json:"restarts"` // 服务的自动重启次数
+}
+
+// 缓存上一次采样的进程，CPU 占用率按两次采样之间的差值计算
+// 主进程变化（重启）后重新开始
+var processSampler struct {
+	sync.Mutex
+	proc      *process.Process
+	createdAt int64
+}
+
+// 获取 hysteria 主进程的资源占用，服务未运行时返回 ErrServiceNotRunning
+func (h *Hysteria2Service) GetProcessMetrics() (*ProcessMetrics, error) {
+	unit, err := h.unitStatus()
+	if err != nil {
+		return nil, err
+	}
+	if unit.MainPID == 0 {
+		return nil, ErrServiceNotRunning
+	}
+
+	metrics, err := sampleProcess(int32(unit.MainPID))
+	if err != nil {
+		return nil, err
+	}
+	metrics.Restarts = unit.NRestarts
+	return metrics, nil
+}
+
+func sampleProcess(pid int32) (*ProcessMetrics, error) {
+	processSampler.Lock()
+	defer processSampler.Unlock()
+
+	proc, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: process %d not found", ErrServiceNotRunning, pid)
+	}
+	createdAt, err := proc.CreateTime()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process %d: %v", pid, err)
+	}
+
+	// 同一个进程时沿用上一次的采样，否则先等待一小段时间采样
+	var cpuPercent float64
+	if processSampler.proc != nil && processSampler.proc.Pid == pid && processSampler.createdAt == createdAt {
+		proc = processSampler.proc
+		cpuPercent, err = proc.Percent(0)
+	} else {
+		cpuPercent, err = proc.Percent(firstCPUSampleInterval)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cpu usage of process %d: %v", pid, err)
+	}
+	processSampler.proc = proc
+	processSampler.createdAt = createdAt
+
+	startTime := time.UnixMilli(createdAt)
+	metrics := &ProcessMetrics{
+		PID:        pid,
+		CPUPercent: cpuPercent,
+		StartTime:  startTime,
+		Uptime:     int64(time.Since(startTime).Seconds()),
+	}
+	if mem, err := proc.MemoryInfo(); err == nil {
+		metrics.RSS = mem.RSS
+	}
+	if threads, err := proc.NumThreads(); err == nil {
+		metrics.Threads = threads
+	}
+	if fds, err := proc.NumFDs(); err == nil {
+		metrics.OpenFDs = fds
+	}
+	if limits, err := proc.Rlimit(); err == nil {
+		for _, limit := range limits {
+			if limit.Resource == process.RLIMIT_NOFILE {
+				metrics.MaxFDs = limit.Soft
+			}
+		}
+	}
+	if conns, err := gopsnet.ConnectionsPid("udp", pid); err == nil {
+		metrics.UDPSockets = len(conns)
+	}
+	return metrics, nil
+}
+
+// 格式化运行时间，如 "2d 5h 30m"
+func formatUptime(d time.Duration) string {
+	minutes := int64(d / time.Minute)
+	days, hours, minutes := minutes/(24*60), minutes/60%24, minutes%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	salamanderSaltLen   = 8
+	salamanderMinPSKLen = 4
+	maxUDPPacketSize    = 2048
+)
+
+// Salamander 混淆的客户端实现，与 hysteria 的 obfs.type: salamander 对应
+// 每个数据包格式为 [8 字节随机盐][负载]，负载与 BLAKE2b-256(密码 + 盐) 循环异或
+type salamanderConn struct {
+	net.PacketConn
+	psk    []byte
+	buffer []byte
+}
+
+func newSalamanderConn(conn net.PacketConn, password string) (*salamanderConn, error) {
+	if len(password) < salamanderMinPSKLen {
+		return nil, fmt.Errorf("salamander password must be at least %d bytes", salamanderMinPSKLen)
+	}
+	return &salamanderConn{
+		PacketConn: conn,
+		psk:        []byte(password),
+		buffer:     make([]byte, maxUDPPacketSize),
+	}, nil
+}
+
+func (c *salamanderConn) key(salt []byte) [blake2b.Size256]byte {
+	return blake2b.Sum256(append(append([]byte{}, c.psk...), salt...))
+}
+
+// 读取并还原数据包，无法还原的包直接丢弃
+func (c *salamanderConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(c.buffer)
+		if err != nil {
+			return 0, addr, err
+		}
+		if n <= salamanderSaltLen || n-salamanderSaltLen > len(p) {
+			continue
+		}
+		key := c.key(c.buffer[:salamanderSaltLen])
+		for i, b := range c.buffer[salamanderSaltLen:n] {
+			p[i] = b ^ key[i%len(key)]
+		}
+		return n - salamanderSaltLen, addr, nil
+	}
+}
+
+func (c *salamanderConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	out := make([]byte, salamanderSaltLen+len(p))
+	if _, err := rand.Read(out[:salamanderSaltLen]); err != nil {
+		return 0, err
+	}
+	key := c.key(out[:salamanderSaltLen])
+	for i, b := range p {
+		out[salamanderSaltLen+i] = b ^ key[i%len(key)]
+	}
+	if _, err := c.PacketConn.WriteTo(out, addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
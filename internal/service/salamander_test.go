@@ -0,0 +1,145 @@
+package service
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func listenTestUDP(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func newTestSalamanderConn(t *testing.T, conn net.PacketConn, password string) *salamanderConn {
+	t.Helper()
+	obfsConn, err := newSalamanderConn(conn, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obfsConn
+}
+
+func TestSalamanderRoundTrip(t *testing.T) {
+	a := newTestSalamanderConn(t, listenTestUDP(t), "gawrgura")
+	b := newTestSalamanderConn(t, listenTestUDP(t), "gawrgura")
+
+	// 包含短于和长于一个密钥长度（32 字节）的包
+	payloads := [][]byte{
+		[]byte("hello"),
+		bytes.Repeat([]byte{0xAB}, 100),
+		make([]byte, 1200),
+	}
+	buf := make([]byte, maxUDPPacketSize)
+	for _, payload := range payloads {
+		n, err := a.WriteTo(payload, b.LocalAddr())
+		if err != nil || n != len(payload) {
+			t.Fatalf("WriteTo = %d, %v; want %d", n, err, len(payload))
+		}
+		n, addr, err := b.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+		if !bytes.Equal(buf[:n], payload) {
+			t.Errorf("ReadFrom = %x, want %x", buf[:n], payload)
+		}
+		if addr.String() != a.LocalAddr().String() {
+			t.Errorf("ReadFrom addr = %s, want %s", addr, a.LocalAddr())
+		}
+	}
+}
+
+// 按格式手动解析线上的数据包：[8 字节盐][负载 XOR BLAKE2b-256(密码 + 盐)]
+func TestSalamanderWireFormat(t *testing.T) {
+	raw := listenTestUDP(t)
+	a := newTestSalamanderConn(t, listenTestUDP(t), "gawrgura")
+
+	payload := []byte("the quick brown fox jumps over the lazy dog")
+	if _, err := a.WriteTo(payload, raw.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	packet := make([]byte, maxUDPPacketSize)
+	n, _, err := raw.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != salamanderSaltLen+len(payload) {
+		t.Fatalf("packet length = %d, want %d", n, salamanderSaltLen+len(payload))
+	}
+	salt := packet[:salamanderSaltLen]
+	key := blake2b.Sum256(append([]byte("gawrgura"), salt...))
+	decoded := make([]byte, len(payload))
+	for i := range decoded {
+		decoded[i] = packet[salamanderSaltLen+i] ^ key[i%len(key)]
+	}
+	if !bytes.Equal(decoded, payload) {
+		t.Errorf("decoded = %q, want %q", decoded, payload)
+	}
+
+	// 每个包使用新的盐
+	if _, err := a.WriteTo(payload, raw.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	second := make([]byte, maxUDPPacketSize)
+	if _, _, err := raw.ReadFrom(second); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(second[:salamanderSaltLen], salt) {
+		t.Errorf("salt was reused: %x", salt)
+	}
+}
+
+func TestSalamanderDropsShortPackets(t *testing.T) {
+	raw := listenTestUDP(t)
+	b := newTestSalamanderConn(t, listenTestUDP(t), "gawrgura")
+	a := newTestSalamanderConn(t, raw, "gawrgura")
+
+	// 只有盐没有负载的包被丢弃，随后的正常包可以读到
+	if _, err := raw.WriteTo(make([]byte, salamanderSaltLen), b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.WriteTo([]byte("ok"), b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxUDPPacketSize)
+	n, _, err := b.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "ok" {
+		t.Errorf("ReadFrom = %q, want %q", buf[:n], "ok")
+	}
+}
+
+func TestSalamanderWrongPassword(t *testing.T) {
+	a := newTestSalamanderConn(t, listenTestUDP(t), "gawrgura")
+	b := newTestSalamanderConn(t, listenTestUDP(t), "not-gura")
+
+	payload := []byte("hello salamander")
+	if _, err := a.WriteTo(payload, b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxUDPPacketSize)
+	n, _, err := b.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(buf[:n], payload) {
+		t.Error("payload decoded with the wrong password")
+	}
+}
+
+func TestSalamanderPasswordTooShort(t *testing.T) {
+	if _, err := newSalamanderConn(listenTestUDP(t), "abc"); err == nil {
+		t.Error("newSalamanderConn accepted a 3-byte password")
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	systemd "github.com/coreos/go-systemd/v22/dbus"
+)
+
+const (
+	hysteriaUnitName = "hysteria-server.service"
+
+	// 等待 systemd 任务完成的最长时间
+	unitJobTimeout = 30 * time.Second
+)
+
+var (
+	ErrUnitJobFailed = fmt.Errorf("systemd job failed")
+	ErrUnitNotFound  = fmt.Errorf("unit not found")
+)
+
+// systemd 服务单元状态，直接取自单元属性
+type UnitStatus struct {
+	LoadState      string     `json:"load_state"`             // loaded, not-found, masked 等
+	ActiveState    string     `json:"active_state"`           // active, inactive, failed, activating 等
+	SubState       string     `json:"sub_state"`              // running, dead, exited, auto-restart 等
+	Result         string     `json:"result"`                 // 最后一次运行的结果，success, exit-code, signal 等
+	MainPID        uint32     `json:"main_pid"`               // 主进程 PID，未运行时为 0
+	ExecMainStatus int32      `json:"exec_main_status"`       // 主进程最后一次退出的状态码
+	ActiveSince    *time.Time `json:"active_since,omitempty"` // 最近一次进入 active 状态的时间
+	NRestarts      uint32     `json:"n_restarts"`             // 由 Restart= 触发的自动重启次数
+}
+
+// 是否正在运行
+func (s *UnitStatus) Running() bool {
+	return s.ActiveState == "active" && s.SubState == "running"
+}
+
+// 服务管理接口，启动、停止和重启在对应的 systemd 任务完成后才返回
+type ServiceManager interface {
+	Status(ctx context.Context, unit string) (*UnitStatus, error)
+	Start(ctx context.Context, unit string) error
+	Stop(ctx context.Context, unit string) error
+	Restart(ctx context.Context, unit string) error
+	Enable(ctx context.Context, unit string) error
+	Disable(ctx context.Context, unit string) error
+	Reload(ctx context.Context) error
+}
+
+// 通过 D-Bus 与 systemd 通信的服务管理，连接在首次使用时建立，断开后自动重连
+type SystemdManager struct {
+	mu   sync.Mutex
+	conn *systemd.Conn
+}
+
+// 所有 Hysteria2Service 共享同一个 D-Bus 连接
+var defaultServiceManager = NewSystemdManager()
+
+func NewSystemdManager() *SystemdManager {
+	return &SystemdManager{}
+}
+
+func (m *SystemdManager) connect(ctx context.Context) (*systemd.Conn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conn != nil && m.conn.Connected() {
+		return m.conn, nil
+	}
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+	conn, err := systemd.NewWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to systemd: %v", err)
+	}
+	m.conn = conn
+	return conn, nil
+}
+
+// 读取单元属性
+func (m *SystemdManager) Status(ctx context.Context, unit string) (*UnitStatus, error) {
+	conn, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	props, err := conn.GetUnitPropertiesContext(ctx, unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get properties of %s: %v", unit, err)
+	}
+
+	status := &UnitStatus{}
+	status.LoadState, _ = props["LoadState"].(string)
+	status.ActiveState, _ = props["ActiveState"].(string)
+	status.SubState, _ = props["SubState"].(string)
+	if usec, _ := props["ActiveEnterTimestamp"].(uint64); usec > 0 {
+		since := time.UnixMicro(int64(usec))
+		status.ActiveSince = &since
+	}
+	if status.LoadState == "not-found" {
+		return status, fmt.Errorf("%w: %s", ErrUnitNotFound, unit)
+	}
+
+	serviceProps, err := conn.GetUnitTypePropertiesContext(ctx, unit, "Service")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service properties of %s: %v", unit, err)
+	}
+	status.Result, _ = serviceProps["Result"].(string)
+	status.MainPID, _ = serviceProps["MainPID"].(uint32)
+	status.ExecMainStatus, _ = serviceProps["ExecMainStatus"].(int32)
+	status.NRestarts, _ = serviceProps["NRestarts"].(uint32)
+	return status, nil
+}
+
+func (m *SystemdManager) Start(ctx context.Context, unit string) error {
+	return m.runJob(ctx, "start", unit, (*systemd.Conn).StartUnitContext)
+}
+
+func (m *SystemdManager) Stop(ctx context.Context, unit string) error {
+	return m.runJob(ctx, "stop", unit, (*systemd.Conn).StopUnitContext)
+}
+
+func (m *SystemdManager) Restart(ctx context.Context, unit string) error {
+	return m.runJob(ctx, "restart", unit, (*systemd.Conn).RestartUnitContext)
+}
+
+// 设置开机自启
+func (m *SystemdManager) Enable(ctx context.Context, unit string) error {
+	conn, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if _, _, err := conn.EnableUnitFilesContext(ctx, []string{unit}, false, true); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", unit, err)
+	}
+	return nil
+}
+
+// 取消开机自启
+func (m *SystemdManager) Disable(ctx context.Context, unit string) error {
+	conn, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.DisableUnitFilesContext(ctx, []string{unit}, false); err != nil {
+		return fmt.Errorf("failed to disable %s: %v", unit, err)
+	}
+	return nil
+}
+
+// 重新加载单元文件，相当于 systemctl daemon-reload
+func (m *SystemdManager) Reload(ctx context.Context) error {
+	conn, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := conn.ReloadContext(ctx); err != nil {
+		return fmt.Errorf("failed to reload systemd: %v", err)
+	}
+	return nil
+}
+
+type unitJobFunc func(c *systemd.Conn, ctx context.Context, name, mode string, ch chan<- string) (int, error)
+
+// 提交任务并等待其完成，任务结果不是 done 时返回 ErrUnitJobFailed
+func (m *SystemdManager) runJob(ctx context.Context, action, unit string, job unitJobFunc) error {
+	conn, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 等待超时后 systemd 仍可能发送结果，使用带缓冲的通道避免阻塞
+	done := make(chan string, 1)
+	if _, err := job(conn, ctx, unit, "replace", done); err != nil {
+		return fmt.Errorf("failed to %s %s: %v", action, unit, err)
+	}
+
+	select {
+	case result := <-done:
+		if result != "done" {
+			return fmt.Errorf("%w: %s %s: %s", ErrUnitJobFailed, action, unit, result)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s %s: %v", ErrUnitJobFailed, action, unit, ctx.Err())
+	}
+}
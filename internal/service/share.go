@@ -0,0 +1,309 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// hysteria2:// 分享链接中的字段
+type ShareLink struct {
+	Name         string `json:"name,omitempty"`
+	Host         string `json:"host"`
+	Port         string `json:"port"`           // 单个端口或端口跳跃范围，如 "443" 或 "20000-30000"
+	Auth         string `json:"auth"`           // 认证字符串，userpass 为 "用户名:密码"
+	Obfs         string `json:"obfs,omitempty"` // 混淆类型，如 salamander
+	ObfsPassword string `json:"obfs_password,omitempty"`
+	SNI          string `json:"sni,omitempty"`
+	Insecure     bool   `json:"insecure,omitempty"`
+	PinSHA256    string `json:"pin_sha256,omitempty"`
+	URI          string `json:"uri"`
+
+	CertificatePEM string `json:"-"` // 自签名证书的 PEM，供不支持指纹校验的客户端直接信任该证书
+}
+
+type ShareService struct {
+	hy2Service    *Hysteria2Service
+	statusService *StatusService
+	userService   *UserService
+}
+
+var ErrInvalidShareURI = fmt.Errorf("invalid hysteria2 uri")
+
+func NewShareService(userService *UserService) *ShareService {
+	return &ShareService{
+		hy2Service:    NewHysteria2Service(),
+		statusService: NewStatusService(),
+		userService:   userService,
+	}
+}
+
+// 根据当前配置生成用户的分享链接，host 为空时使用节点的公网地址
+func (s *ShareService) GetShareLink(username, host string) (*ShareLink, error) {
+	user, err := s.userService.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.hy2Service.GetParsedConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &ShareLink{
+		Name: username,
+		Auth: user.Username + ":" + user.Password,
+		Port: cfg.ListenPort(),
+	}
+	if link.Port == "" {
+		link.Port = "443"
+	}
+	// 启用端口跳跃时使用跳跃范围
+	if hopping, err := NewPortHoppingService().GetConfig(); err == nil && hopping.Enabled {
+		link.Port = fmt.Sprintf("%d-%d", hopping.StartPort, hopping.EndPort)
+	}
+
+	if cfg.Obfs != nil && cfg.Obfs.Type == "salamander" && cfg.Obfs.Salamander != nil {
+		link.Obfs = "salamander"
+		link.ObfsPassword = cfg.Obfs.Salamander.Password
+	}
+
+	// ACME 证书直接使用域名；自备证书时从证书中获取 SNI，自签名证书使用证书指纹校验
+	switch {
+	case cfg.ACME != nil && len(cfg.ACME.Domains) > 0:
+		link.Host = cfg.ACME.Domains[0]
+	case cfg.TLS != nil && cfg.TLS.Cert != "":
+		cert, err := loadCertificate(cfg.TLS.Cert)
+		if err != nil {
+			return nil, err
+		}
+		if len(cert.DNSNames) > 0 {
+			link.SNI = cert.DNSNames[0]
+		}
+		if isSelfSigned(cert) {
+			link.Insecure = true
+			link.PinSHA256 = certSHA256(cert)
+			link.CertificatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		}
+	}
+
+	if host != "" {
+		link.Host = host
+	}
+	if link.Host == "" {
+		if link.Host, err = s.publicAddress(); err != nil {
+			return nil, err
+		}
+	}
+	// 主机即为 SNI 时无需重复
+	if link.SNI == link.Host {
+		link.SNI = ""
+	}
+
+	link.URI = link.String()
+	return link, nil
+}
+
+// 生成分享链接的二维码
+func (s *ShareService) GetShareQRCode(username, host string, size int) ([]byte, error) {
+	link, err := s.GetShareLink(username, host)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		size = 256
+	}
+	return qrcode.Encode(link.URI, qrcode.Medium, size)
+}
+
+// 节点的公网地址，优先使用公网 IPv4
+func (s *ShareService) publicAddress() (string, error) {
+	info, err := s.statusService.GetSystemInfo()
+	if err != nil {
+		return "", err
+	}
+	for _, addrs := range [][]string{info.IPv4, info.IPv6} {
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() {
+				return addr, nil
+			}
+		}
+	}
+	if len(info.IPv4) > 0 {
+		return info.IPv4[0], nil
+	}
+	if len(info.IPv6) > 0 {
+		return info.IPv6[0], nil
+	}
+	return "", fmt.Errorf("no public address found")
+}
+
+// 生成 hysteria2:// 链接
+func (l *ShareLink) String() string {
+	u := url.URL{
+		Scheme: "hysteria2",
+		Host:   l.Host + ":" + l.Port,
+		Path:   "/",
+	}
+	if strings.Contains(l.Host, ":") {
+		u.Host = "[" + l.Host + "]:" + l.Port
+	}
+	if name, password, ok := strings.Cut(l.Auth, ":"); ok {
+		u.User = url.UserPassword(name, password)
+	} else if l.Auth != "" {
+		u.User = url.User(l.Auth)
+	}
+
+	query := url.Values{}
+	if l.Obfs != "" {
+		query.Set("obfs", l.Obfs)
+		query.Set("obfs-password", l.ObfsPassword)
+	}
+	if l.SNI != "" {
+		query.Set("sni", l.SNI)
+	}
+	if l.Insecure {
+		query.Set("insecure", "1")
+	}
+	if l.PinSHA256 != "" {
+		query.Set("pinSHA256", l.PinSHA256)
+	}
+	u.RawQuery = query.Encode()
+	u.Fragment = l.Name
+	return u.String()
+}
+
+// 解析 hysteria2:// 或 hy2:// 链接
+func ParseShareURI(uri string) (*ShareLink, error) {
+	uri = strings.TrimSpace(uri)
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok || (scheme != "hysteria2" && scheme != "hy2") {
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidShareURI, scheme)
+	}
+
+	// 端口可能是范围或列表，url.Parse 无法解析，先取出端口再解析其余部分
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	authority := rest[:end]
+	userinfo, hostport := "", authority
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userinfo, hostport = authority[:i+1], authority[i+1:]
+	}
+	host, port := hostport, "443"
+	if i := strings.LastIndex(hostport, ":"); i >= 0 && !strings.HasSuffix(hostport, "]") {
+		host, port = hostport[:i], hostport[i+1:]
+	}
+	if strings.Trim(host, "[]") == "" {
+		return nil, fmt.Errorf("%w: missing host", ErrInvalidShareURI)
+	}
+	if err := validatePortSpec(port); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShareURI, err)
+	}
+
+	u, err := url.Parse(scheme + "://" + userinfo + host + rest[end:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShareURI, err)
+	}
+	host = u.Hostname()
+
+	link := &ShareLink{
+		Name: u.Fragment,
+		Host: host,
+		Port: port,
+	}
+	if u.User != nil {
+		link.Auth = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			link.Auth += ":" + password
+		}
+	}
+
+	query := u.Query()
+	link.Obfs = query.Get("obfs")
+	link.ObfsPassword = query.Get("obfs-password")
+	link.SNI = query.Get("sni")
+	link.Insecure = query.Get("insecure") == "1" || query.Get("insecure") == "true"
+	link.PinSHA256 = query.Get("pinSHA256")
+	link.URI = link.String()
+	return link, nil
+}
+
+// 转换为服务端配置中对应的字段
+func (l *ShareLink) ToConfig() *Hysteria2Config {
+	cfg := &Hysteria2Config{}
+
+	// 端口跳跃时服务端只监听第一个端口
+	port := strings.SplitN(strings.SplitN(l.Port, ",", 2)[0], "-", 2)[0]
+	cfg.Listen = ":" + port
+
+	if name, password, ok := strings.Cut(l.Auth, ":"); ok {
+		cfg.Auth = &AuthConfig{
+			Type:     "userpass",
+			UserPass: map[string]string{name: password},
+		}
+	} else if l.Auth != "" {
+		cfg.Auth = &AuthConfig{
+			Type:     "password",
+			Password: l.Auth,
+		}
+	}
+
+	if l.Obfs != "" {
+		cfg.Obfs = &ObfsConfig{
+			Type:       l.Obfs,
+			Salamander: &SalamanderConfig{Password: l.ObfsPassword},
+		}
+	}
+	return cfg
+}
+
+// 校验端口格式，支持 "443"、"20000-30000"、"443,20000-30000"
+func validatePortSpec(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		for _, port := range strings.SplitN(part, "-", 2) {
+			n, err := strconv.Atoi(port)
+			if err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("invalid port %q", spec)
+			}
+		}
+	}
+	return nil
+}
+
+// 读取 PEM 证书文件中的第一个证书
+func loadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// 是否为自签名证书：颁发者与主题相同，且签名可以用证书自身的公钥验证
+// 不使用 CheckSignatureFrom，它要求证书是 CA，openssl 等工具生成的自签名叶子证书通常不是
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// 证书的 SHA-256 指纹
+func certSHA256(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
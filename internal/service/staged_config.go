@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	stagedConfigPath          = "/etc/hy2agent/staged_configs.json"
+	maxStagedHistory          = 50 // 保留的已结束变更数量
+	DefaultStageCheckInterval = 15 * time.Second
+)
+
+// 计划变更状态
+const (
+	StagePending   = "pending"
+	StageApplying  = "applying"
+	StageApplied   = "applied"
+	StageFailed    = "failed"
+	StageCancelled = "cancelled"
+)
+
+var (
+	ErrStageNotFound   = fmt.Errorf("staged config not found")
+	ErrStageNotPending = fmt.Errorf("staged config is not pending")
+	ErrInvalidStage    = fmt.Errorf("invalid staged config")
+)
+
+// 计划在指定时间应用的配置
+type StagedConfig struct {
+	ID         string     `json:"id"`
+	Config     string     `json:"config,omitempty"`
+	ApplyAt    time.Time  `json:"apply_at"`
+	Note       string     `json:"note,omitempty"`
+	BaseHash   string     `json:"base_hash,omitempty"` // 不为空时，只有当前配置仍为该哈希才应用
+	State      string     `json:"state"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"` // 应用完成、失败或取消的时间
+
+	// 应用结果
+	BackupFile string `json:"backup_file,omitempty"`
+	RolledBack bool   `json:"rolled_back,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// 计划变更，到期后通过与 UpdateConfig 相同的备份、重启和回滚流程应用
+// 记录保存在磁盘上，agent 重启后继续生效
+type StagedConfigService struct {
+	mu         sync.Mutex
+	path       string
+	stages     map[string]*StagedConfig
+	hy2Service *Hysteria2Service
+}
+
+// 加载磁盘上的计划变更，agent 退出时正在应用的变更标记为失败
+func NewStagedConfigService() (*StagedConfigService, error) {
+	s := &StagedConfigService{
+		path:       stagedConfigPath,
+		stages:     make(map[string]*StagedConfig),
+		hy2Service: NewHysteria2Service(),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var stages []*StagedConfig
+		if err := json.Unmarshal(data, &stages); err != nil {
+			return nil, err
+		}
+		for _, stage := range stages {
+			if stage.State == StageApplying {
+				now := time.Now()
+				stage.State = StageFailed
+				stage.FinishedAt = &now
+				stage.Error = "agent restarted while the config was being applied"
+			}
+			s.stages[stage.ID] = stage
+		}
+	}
+	return s, nil
+}
+
+// 提交计划变更
+func (s *StagedConfigService) Stage(config string, applyAt time.Time, note, baseHash string) (*StagedConfig, error) {
+	if config == "" {
+		return nil, fmt.Errorf("%w: config is required", ErrInvalidStage)
+	}
+	if !applyAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: apply_at must be in the future", ErrInvalidStage)
+	}
+
+	stage := &StagedConfig{
+		ID:        newJobID(),
+		Config:    config,
+		ApplyAt:   applyAt,
+		Note:      note,
+		BaseHash:  baseHash,
+		State:     StagePending,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stages[stage.ID] = stage
+	if err := s.save(); err != nil {
+		delete(s.stages, stage.ID)
+		return nil, err
+	}
+	copied := *stage
+	return &copied, nil
+}
+
+// 按计划时间列出，不包含配置内容
+func (s *StagedConfigService) List() []StagedConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stages := make([]StagedConfig, 0, len(s.stages))
+	for _, stage := range s.stages {
+		copied := *stage
+		copied.Config = ""
+		stages = append(stages, copied)
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].ApplyAt.Before(stages[j].ApplyAt)
+	})
+	return stages
+}
+
+// 获取计划变更，包含配置内容
+func (s *StagedConfigService) Get(id string) (*StagedConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stage, ok := s.stages[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStageNotFound, id)
+	}
+	copied := *stage
+	return &copied, nil
+}
+
+// 取消尚未应用的计划变更
+func (s *StagedConfigService) Cancel(id string) (*StagedConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stage, ok := s.stages[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStageNotFound, id)
+	}
+	if stage.State != StagePending {
+		return nil, fmt.Errorf("%w: %s is %s", ErrStageNotPending, id, stage.State)
+	}
+
+	now := time.Now()
+	stage.State = StageCancelled
+	stage.FinishedAt = &now
+	s.prune()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	copied := *stage
+	copied.Config = ""
+	return &copied, nil
+}
+
+// 定时应用到期的变更
+func (s *StagedConfigService) Run(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultStageCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.ApplyDue()
+	}
+}
+
+// 按计划时间依次应用到期的变更，agent 停机期间错过的变更会在启动后补上
+// 操作锁被占用时留到下一次检查
+func (s *StagedConfigService) ApplyDue() {
+	for {
+		id := s.nextDue()
+		if id == "" {
+			return
+		}
+
+		lease, ctx, err := BeginOperation(context.Background(), "apply_staged_config")
+		if err != nil {
+			log.Printf("计划变更 %s 已到期，等待下一次检查: %v", id, err)
+			return
+		}
+		if stage := s.markApplying(id); stage != nil {
+			s.apply(ctx, stage)
+		}
+		lease.Release()
+	}
+}
+
+// 最早到期的变更
+func (s *StagedConfigService) nextDue() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due *StagedConfig
+	now := time.Now()
+	for _, stage := range s.stages {
+		if stage.State != StagePending || stage.ApplyAt.After(now) {
+			continue
+		}
+		if due == nil || stage.ApplyAt.Before(due.ApplyAt) {
+			due = stage
+		}
+	}
+	if due == nil {
+		return ""
+	}
+	return due.ID
+}
+
+// 标记为正在应用，期间被取消时返回 nil
+func (s *StagedConfigService) markApplying(id string) *StagedConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stage, ok := s.stages[id]
+	if !ok || stage.State != StagePending {
+		return nil
+	}
+	stage.State = StageApplying
+	if err := s.save(); err != nil {
+		log.Printf("保存计划变更失败: %v", err)
+	}
+	copied := *stage
+	return &copied
+}
+
+func (s *StagedConfigService) apply(ctx context.Context, stage *StagedConfig) {
+	var result *ConfigApplyResult
+	var err error
+	if stage.BaseHash != "" {
+		_, err = s.hy2Service.MatchConfigHash([]string{stage.BaseHash})
+	}
+	if err == nil {
+		result, err = s.hy2Service.UpdateConfig(ctx, stage.Config)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.stages[stage.ID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	current.FinishedAt = &now
+	if err != nil {
+		current.State = StageFailed
+		current.Error = err.Error()
+		var applyErr *ConfigApplyError
+		if errors.As(err, &applyErr) {
+			current.BackupFile = applyErr.BackupFile
+			current.RolledBack = applyErr.RolledBack
+		}
+		log.Printf("应用计划变更 %s 失败: %v", stage.ID, err)
+	} else {
+		current.State = StageApplied
+		current.BackupFile = result.BackupFile
+		log.Printf("已应用计划变更 %s", stage.ID)
+	}
+
+	s.prune()
+	if err := s.save(); err != nil {
+		log.Printf("保存计划变更失败: %v", err)
+	}
+}
+
+// 删除超出数量的已结束变更，调用时需持有锁
+func (s *StagedConfigService) prune() {
+	var finished []*StagedConfig
+	for _, stage := range s.stages {
+		if stage.State == StageApplied || stage.State == StageFailed || stage.State == StageCancelled {
+			finished = append(finished, stage)
+		}
+	}
+	if len(finished) <= maxStagedHistory {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].ApplyAt.After(finished[j].ApplyAt)
+	})
+	for _, stage := range finished[maxStagedHistory:] {
+		delete(s.stages, stage.ID)
+	}
+}
+
+// 写入文件，先写临时文件再重命名，调用时需持有锁
+func (s *StagedConfigService) save() error {
+	stages := make([]*StagedConfig, 0, len(s.stages))
+	for _, stage := range s.stages {
+		stages = append(stages, stage)
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		return stages[i].ApplyAt.Before(stages[j].ApplyAt)
+	})
+
+	data, err := json.MarshalIndent(stages, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 订阅格式
+const (
+	SubFormatBase64    = "base64"    // base64 编码的链接列表
+	SubFormatClash     = "clash"     // Clash Meta (mihomo) YAML
+	SubFormatSingBox   = "singbox"   // sing-box JSON
+	SubFormatHysteria2 = "hysteria2" // hysteria2 官方客户端 YAML
+)
+
+var ErrUnknownSubFormat = fmt.Errorf("unknown subscription format")
+
+// 订阅内容
+type Subscription struct {
+	Content     []byte
+	ContentType string
+	UserInfo    string // subscription-userinfo 响应头，无流量数据时为空
+}
+
+// 订阅服务，使用独立于 API Key 的订阅令牌
+// 令牌由 API Key 对用户名和密码签名得到，修改用户密码后旧令牌自动失效
+type SubscriptionService struct {
+	secret       []byte
+	userService  *UserService
+	shareService *ShareService
+}
+
+func NewSubscriptionService(secret string, userService *UserService) *SubscriptionService {
+	return &SubscriptionService{
+		secret:       []byte(secret),
+		userService:  userService,
+		shareService: NewShareService(userService),
+	}
+}
+
+// 用户的订阅令牌
+func (s *SubscriptionService) Token(user *HysteriaUser) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(user.Username + ":" + user.Password))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// 获取用户的订阅令牌
+func (s *SubscriptionService) GetToken(username string) (string, error) {
+	user, err := s.userService.GetUser(username)
+	if err != nil {
+		return "", err
+	}
+	return s.Token(user), nil
+}
+
+// 根据令牌查找用户
+func (s *SubscriptionService) FindUser(token string) (*HysteriaUser, error) {
+	users, err := s.userService.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if hmac.Equal([]byte(s.Token(&users[i])), []byte(token)) {
+			return &users[i], nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// 根据 User-Agent 判断订阅格式
+func DetectSubFormat(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "clash"), strings.Contains(ua, "mihomo"), strings.Contains(ua, "stash"):
+		return SubFormatClash
+	case strings.Contains(ua, "sing-box"), strings.Contains(ua, "sfa"), strings.Contains(ua, "sfi"), strings.Contains(ua, "sfm"):
+		return SubFormatSingBox
+	case strings.Contains(ua, "hysteria"):
+		return SubFormatHysteria2
+	}
+	return SubFormatBase64
+}
+
+// 生成订阅内容
+func (s *SubscriptionService) Render(user *HysteriaUser, format string) (*Subscription, error) {
+	link, err := s.shareService.GetShareLink(user.Username, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscription{}
+	if s.trafficAvailable() {
+		sub.UserInfo = subscriptionUserInfo(user)
+	}
+	switch format {
+	case SubFormatBase64, "":
+		sub.ContentType = "text/plain; charset=utf-8"
+		sub.Content = []byte(base64.StdEncoding.EncodeToString([]byte(link.URI + "\n")))
+	case SubFormatClash:
+		sub.ContentType = "text/yaml; charset=utf-8"
+		sub.Content, err = renderClash(link)
+	case SubFormatSingBox:
+		sub.ContentType = "application/json; charset=utf-8"
+		sub.Content, err = renderSingBox(link)
+	case SubFormatHysteria2:
+		sub.ContentType = "text/yaml; charset=utf-8"
+		sub.Content, err = renderHysteria2Client(link)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSubFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// 是否有流量数据：trafficStats 已启用或曾经采集过
+func (s *SubscriptionService) trafficAvailable() bool {
+	status, err := s.userService.trafficService.GetStatus()
+	return err == nil && (status.Enabled || status.LastPoll != nil)
+}
+
+// subscription-userinfo 响应头
+func subscriptionUserInfo(user *HysteriaUser) string {
+	if user.Usage == nil {
+		return ""
+	}
+	parts := []string{
+		fmt.Sprintf("upload=%d", user.Usage.Tx),
+		fmt.Sprintf("download=%d", user.Usage.Rx),
+		fmt.Sprintf("total=%d", user.QuotaBytes),
+	}
+	if user.ExpiresAt != nil {
+		parts = append(parts, fmt.Sprintf("expire=%d", user.ExpiresAt.Unix()))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// 第一个端口和端口跳跃范围
+func splitSharePort(port string) (int, string) {
+	first := strings.SplitN(strings.SplitN(port, ",", 2)[0], "-", 2)[0]
+	n, _ := strconv.Atoi(first)
+	if first == port {
+		return n, ""
+	}
+	return n, port
+}
+
+// Clash Meta 配置
+func renderClash(link *ShareLink) ([]byte, error) {
+	port, ports := splitSharePort(link.Port)
+	proxy := map[string]interface{}{
+		"name":     link.Name,
+		"type":     "hysteria2",
+		"server":   link.Host,
+		"port":     port,
+		"password": link.Auth,
+	}
+	if ports != "" {
+		proxy["ports"] = ports
+	}
+	if link.SNI != "" {
+		proxy["sni"] = link.SNI
+	}
+	if link.Insecure {
+		proxy["skip-cert-verify"] = true
+	}
+	if link.PinSHA256 != "" {
+		proxy["fingerprint"] = link.PinSHA256
+	}
+	if link.Obfs != "" {
+		proxy["obfs"] = link.Obfs
+		proxy["obfs-password"] = link.ObfsPassword
+	}
+
+	return yaml.Marshal(map[string]interface{}{
+		"proxies": []interface{}{proxy},
+		"proxy-groups": []interface{}{
+			map[string]interface{}{
+				"name":    "PROXY",
+				"type":    "select",
+				"proxies": []string{link.Name},
+			},
+		},
+		"rules": []string{"MATCH,PROXY"},
+	})
+}
+
+// sing-box 出站配置
+func renderSingBox(link *ShareLink) ([]byte, error) {
+	port, ports := splitSharePort(link.Port)
+	outbound := map[string]interface{}{
+		"type":        "hysteria2",
+		"tag":         link.Name,
+		"server":      link.Host,
+		"server_port": port,
+		"password":    link.Auth,
+	}
+	if ports != "" {
+		// sing-box 的端口范围使用冒号分隔
+		var serverPorts []string
+		for _, part := range strings.Split(ports, ",") {
+			if strings.Contains(part, "-") {
+				serverPorts = append(serverPorts, strings.Replace(part, "-", ":", 1))
+			}
+		}
+		outbound["server_ports"] = serverPorts
+	}
+	if link.Obfs != "" {
+		outbound["obfs"] = map[string]string{
+			"type":     link.Obfs,
+			"password": link.ObfsPassword,
+		}
+	}
+	tls := map[string]interface{}{"enabled": true}
+	if link.SNI != "" {
+		tls["server_name"] = link.SNI
+	}
+	// sing-box 不支持证书指纹，自签名证书直接作为受信任的证书写入，而不是跳过校验
+	switch {
+	case link.CertificatePEM != "":
+		tls["certificate"] = strings.Split(strings.TrimSpace(link.CertificatePEM), "\n")
+	case link.Insecure:
+		tls["insecure"] = true
+	}
+	outbound["tls"] = tls
+
+	return json.MarshalIndent(map[string]interface{}{
+		"outbounds": []interface{}{outbound},
+	}, "", "  ")
+}
+
+// hysteria2 官方客户端配置
+func renderHysteria2Client(link *ShareLink) ([]byte, error) {
+	host := link.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	cfg := map[string]interface{}{
+		"server": host + ":" + link.Port,
+		"auth":   link.Auth,
+		"socks5": map[string]string{"listen": "127.0.0.1:1080"},
+		"http":   map[string]string{"listen": "127.0.0.1:8080"},
+	}
+	if link.Obfs != "" {
+		cfg["obfs"] = map[string]interface{}{
+			"type":    link.Obfs,
+			link.Obfs: map[string]string{"password": link.ObfsPassword},
+		}
+	}
+	tls := map[string]interface{}{}
+	if link.SNI != "" {
+		tls["sni"] = link.SNI
+	}
+	if link.Insecure {
+		tls["insecure"] = true
+	}
+	if link.PinSHA256 != "" {
+		tls["pinSHA256"] = link.PinSHA256
+	}
+	if len(tls) > 0 {
+		cfg["tls"] = tls
+	}
+	return yaml.Marshal(cfg)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRenderSingBoxTLS(t *testing.T) {
+	const certPEM = "-----BEGIN CERTIFICATE-----\nMIIB\nAQAB\n-----END CERTIFICATE-----\n"
+
+	tests := []struct {
+		name string
+		link ShareLink
+		want map[string]interface{}
+	}{
+		{
+			name: "trusted certificate",
+			link: ShareLink{SNI: "example.com"},
+			want: map[string]interface{}{"enabled": true, "server_name": "example.com"},
+		},
+		{
+			name: "self-signed certificate is trusted instead of skipping verification",
+			link: ShareLink{SNI: "example.com", Insecure: true, PinSHA256: "ba88", CertificatePEM: certPEM},
+			want: map[string]interface{}{
+				"enabled":     true,
+				"server_name": "example.com",
+				"certificate": []interface{}{"-----BEGIN CERTIFICATE-----", "MIIB", "AQAB", "-----END CERTIFICATE-----"},
+			},
+		},
+		{
+			name: "insecure link without certificate",
+			link: ShareLink{Insecure: true},
+			want: map[string]interface{}{"enabled": true, "insecure": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.link.Host = "203.0.113.10"
+			tt.link.Port = "443"
+			data, err := renderSingBox(&tt.link)
+			if err != nil {
+				t.Fatalf("renderSingBox() error: %v", err)
+			}
+			var out struct {
+				Outbounds []struct {
+					TLS map[string]interface{} `json:"tls"`
+				} `json:"outbounds"`
+			}
+			if err := json.Unmarshal(data, &out); err != nil || len(out.Outbounds) != 1 {
+				t.Fatalf("renderSingBox() = %s, %v", data, err)
+			}
+			if got := out.Outbounds[0].TLS; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tls = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	trafficStorePath           = "/etc/hy2agent/traffic.json"
+	DefaultTrafficStatsListen  = "127.0.0.1:18990"
+	DefaultTrafficPollInterval = 30 * time.Second
+)
+
+var ErrTrafficStatsDisabled = fmt.Errorf("trafficStats is not enabled")
+
+// 单个用户的流量
+type UserTraffic struct {
+	Tx uint64 `json:"tx"` // 上传字节数
+	Rx uint64 `json:"rx"` // 下载字节数
+}
+
+// trafficStats 状态
+type TrafficStatsStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Listen    string     `json:"listen,omitempty"`
+	LastPoll  *time.Time `json:"last_poll,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// 持久化的累计流量
+// Users 用于配额检查，只在配额周期重置时清零；Reported 用于流量查询，clear 时清零，两者互不影响
+type trafficState struct {
+	Users     map[string]*UserTraffic `json:"users"`
+	Reported  map[string]*UserTraffic `json:"reported"`
+	UpdatedAt time.Time               `json:"updated_at"`
+}
+
+// 通过 hysteria 的 trafficStats 接口采集流量，累计后持久化，hysteria 重启不会丢失数据
+type TrafficService struct {
+	hy2Service *Hysteria2Service
+	client     *http.Client
+
+	mu        sync.Mutex
+	path      string
+	state     trafficState
+	lastPoll  *time.Time
+	lastError string
+}
+
+func NewTrafficService() (*TrafficService, error) {
+	t := &TrafficService{
+		hy2Service: NewHysteria2Service(),
+		client:     &http.Client{Timeout: 5 * time.Second},
+		path:       trafficStorePath,
+		state: trafficState{
+			Users:    make(map[string]*UserTraffic),
+			Reported: make(map[string]*UserTraffic),
+		},
+	}
+
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		return nil, err
+	}
+	if t.state.Users == nil {
+		t.state.Users = make(map[string]*UserTraffic)
+	}
+	// 旧版本的文件只有 Users，查询计数从配额计数开始
+	if t.state.Reported == nil {
+		t.state.Reported = make(map[string]*UserTraffic, len(t.state.Users))
+		for name, user := range t.state.Users {
+			copied := *user
+			t.state.Reported[name] = &copied
+		}
+	}
+	return t, nil
+}
+
+// 定时采集流量
+func (t *TrafficService) Run(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultTrafficPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := t.Poll(); err != nil && !errors.Is(err, ErrTrafficStatsDisabled) {
+			log.Printf("采集流量失败: %v", err)
+		}
+	}
+}
+
+// 从 hysteria 读取并清零计数，累加到本地
+func (t *TrafficService) Poll() error {
+	var delta map[string]UserTraffic
+	if err := t.request(http.MethodGet, "/traffic?clear=1", nil, &delta); err != nil {
+		t.mu.Lock()
+		if !errors.Is(err, ErrTrafficStatsDisabled) {
+			t.lastError = err.Error()
+		}
+		t.mu.Unlock()
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, traffic := range delta {
+		addTraffic(t.state.Users, name, traffic)
+		addTraffic(t.state.Reported, name, traffic)
+	}
+	now := time.Now()
+	t.state.UpdatedAt = now
+	t.lastPoll = &now
+	t.lastError = ""
+	return t.save()
+}
+
+// 获取上次清零以来的流量，clear 为 true 时返回后清零
+// 清零不影响配额检查使用的累计流量
+func (t *TrafficService) GetTraffic(ctx context.Context, clear bool) (map[string]UserTraffic, error) {
+	if clear {
+		lease, _, err := BeginOperation(ctx, "clear_traffic")
+		if err != nil {
+			return nil, err
+		}
+		defer lease.Release()
+	}
+
+	// 先采集一次，保证数据是最新的
+	if err := t.Poll(); err != nil && !errors.Is(err, ErrTrafficStatsDisabled) {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	traffic := make(map[string]UserTraffic, len(t.state.Reported))
+	for name, user := range t.state.Reported {
+		traffic[name] = *user
+	}
+	if clear {
+		t.state.Reported = make(map[string]*UserTraffic)
+		if err := t.save(); err != nil {
+			return nil, err
+		}
+	}
+	return traffic, nil
+}
+
+// 获取单个用户用于配额检查的累计流量
+func (t *TrafficService) GetUserTraffic(name string) UserTraffic {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if user, ok := t.state.Users[name]; ok {
+		return *user
+	}
+	return UserTraffic{}
+}
+
+// 清零单个用户用于配额检查的累计流量，不影响流量查询
+func (t *TrafficService) ResetUser(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.state.Users[name]; !ok {
+		return nil
+	}
+	delete(t.state.Users, name)
+	return t.save()
+}
+
+func addTraffic(users map[string]*UserTraffic, name string, traffic UserTraffic) {
+	user, ok := users[name]
+	if !ok {
+		user = &UserTraffic{}
+		users[name] = user
+	}
+	user.Tx += traffic.Tx
+	user.Rx += traffic.Rx
+}
+
+// 获取在线用户及其连接数
+func (t *TrafficService) GetOnline() (map[string]int, error) {
+	var online map[string]int
+	if err := t.request(http.MethodGet, "/online", nil, &online); err != nil {
+		return nil, err
+	}
+	return online, nil
+}
+
+// 踢出用户的所有连接
+func (t *TrafficService) Kick(ctx context.Context, users []string) error {
+	body, err := json.Marshal(users)
+	if err != nil {
+		return err
+	}
+
+	lease, _, err := BeginOperation(ctx, "kick")
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+
+	return t.request(http.MethodPost, "/kick", body, nil)
+}
+
+// 获取 trafficStats 状态
+func (t *TrafficService) GetStatus() (*TrafficStatsStatus, error) {
+	cfg, err := t.hy2Service.GetParsedConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := &TrafficStatsStatus{
+		LastPoll:  t.lastPoll,
+		LastError: t.lastError,
+	}
+	if cfg.TrafficStats != nil && cfg.TrafficStats.Listen != "" {
+		status.Enabled = true
+		status.Listen = cfg.TrafficStats.Listen
+	}
+	return status, nil
+}
+
+// 启用或停用 trafficStats，启用时使用回环地址和随机密钥
+func (t *TrafficService) SetEnabled(ctx context.Context, enabled bool) (*ConfigApplyResult, error) {
+	lease, ctx, err := BeginOperation(ctx, "update_traffic_stats")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	doc, err := t.hy2Service.GetConfigDocument()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := doc.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		if cfg.TrafficStats != nil && cfg.TrafficStats.Listen != "" && cfg.TrafficStats.Secret != "" {
+			return &ConfigApplyResult{}, nil
+		}
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		err := doc.Set(&TrafficStatsConfig{
+			Listen: DefaultTrafficStatsListen,
+			Secret: hex.EncodeToString(secret),
+		}, "trafficStats")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if cfg.TrafficStats == nil {
+			return &ConfigApplyResult{}, nil
+		}
+		// 停用前采集最后一次数据
+		t.Poll()
+		doc.Delete("trafficStats")
+	}
+
+	data, err := doc.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return t.hy2Service.applyConfig(ctx, data)
+}
+
+// 调用 trafficStats 接口
+func (t *TrafficService) request(method, path string, body []byte, result interface{}) error {
+	cfg, err := t.hy2Service.GetParsedConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.TrafficStats == nil || cfg.TrafficStats.Listen == "" {
+		return ErrTrafficStatsDisabled
+	}
+
+	// 监听地址为空主机时通过回环地址访问
+	host, port, err := net.SplitHostPort(cfg.TrafficStats.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid trafficStats listen address: %v", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, port), path)
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if cfg.TrafficStats.Secret != "" {
+		req.Header.Set("Authorization", cfg.TrafficStats.Secret)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request trafficStats: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("trafficStats returned %s: %s", resp.Status, string(data))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// 写入文件，先写临时文件再重命名
+func (t *TrafficService) save() error {
+	data, err := json.MarshalIndent(t.state, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := t.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, t.path)
+}
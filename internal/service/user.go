@@ -0,0 +1,653 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type UserService struct {
+	hy2Service     *Hysteria2Service
+	authServer     *AuthServer
+	trafficService *TrafficService
+}
+
+// Hysteria2 用户
+// userpass 模式下用户保存在 auth.userpass 中，始终为启用状态；
+// 内置 HTTP 认证模式下用户保存在用户存储中，支持禁用、过期时间和流量配额
+type HysteriaUser struct {
+	Username       string     `json:"username"`
+	Password       string     `json:"password"`
+	Enabled        bool       `json:"enabled"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	QuotaBytes     uint64     `json:"quota_bytes,omitempty"`     // 每个周期的流量配额，0 表示不限
+	ResetDay       int        `json:"reset_day,omitempty"`       // 每月第几天重置流量，0 表示不重置
+	LastReset      *time.Time `json:"last_reset,omitempty"`      // 上次重置流量的时间
+	DisabledReason string     `json:"disabled_reason,omitempty"` // 被自动禁用的原因
+
+	Usage *UserUsage `json:"usage,omitempty"` // 查询时计算，不持久化
+}
+
+// 用户当前周期的流量使用情况
+type UserUsage struct {
+	Status    string     `json:"status"`              // active, disabled, expired, quota_exceeded
+	Tx        uint64     `json:"tx"`                  // 上传字节数
+	Rx        uint64     `json:"rx"`                  // 下载字节数
+	Used      uint64     `json:"used"`                // 已用流量
+	Remaining *uint64    `json:"remaining,omitempty"` // 剩余流量，不限配额时为空
+	NextReset *time.Time `json:"next_reset,omitempty"`
+}
+
+// 新增或修改用户的参数
+type UserInput struct {
+	Username         string     `json:"username"`
+	Password         string     `json:"password"`
+	GeneratePassword bool       `json:"generate_password"` // 为 true 时忽略 Password 并生成强密码
+	Enabled          *bool      `json:"enabled,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	NoExpiry         bool       `json:"no_expiry,omitempty"` // 为 true 时清除过期时间
+	QuotaBytes       *uint64    `json:"quota_bytes,omitempty"`
+	ResetDay         *int       `json:"reset_day,omitempty"`
+}
+
+// 是否包含仅内置 HTTP 认证支持的字段
+func (in *UserInput) hasPolicy() bool {
+	return in.Enabled != nil || in.ExpiresAt != nil || in.NoExpiry || in.QuotaBytes != nil || in.ResetDay != nil
+}
+
+// 用户认证方式
+const (
+	AuthModeUserpass = "userpass" // 用户保存在 hysteria 配置的 auth.userpass 中
+	AuthModeHTTP     = "http"     // 使用 agent 内置的 HTTP 认证
+)
+
+// 认证方式状态
+type AuthBackendStatus struct {
+	AuthType     string `json:"auth_type"`     // hysteria 配置中的 auth.type
+	AgentManaged bool   `json:"agent_managed"` // 是否使用 agent 内置的 HTTP 认证
+	URL          string `json:"url"`           // 内置 HTTP 认证地址
+	Users        int    `json:"users"`         // 用户存储中的用户数
+}
+
+// 用户状态
+const (
+	UserStatusActive        = "active"
+	UserStatusDisabled      = "disabled"
+	UserStatusExpired       = "expired"
+	UserStatusQuotaExceeded = "quota_exceeded"
+)
+
+var (
+	ErrAuthNotManaged = fmt.Errorf("auth type is neither userpass nor agent http auth")
+	ErrUserNotFound   = fmt.Errorf("user not found")
+	ErrUserExists     = fmt.Errorf("user already exists")
+	ErrInvalidUser    = fmt.Errorf("invalid user")
+)
+
+// 用户名只允许常见字符，且不能包含 userpass 认证中用作分隔符的冒号
+// hysteria 认证 userpass 用户时会把用户名转为小写，上报流量和踢出用户也使用小写的 ID，
+// 因此用户名统一保存为小写，见 normalizeUsername
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.@-]{1,64}$`)
+
+const (
+	generatedPasswordLength  = 24
+	generatedPasswordCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+func NewUserService(authServer *AuthServer, trafficService *TrafficService) *UserService {
+	return &UserService{
+		hy2Service:     NewHysteria2Service(),
+		authServer:     authServer,
+		trafficService: trafficService,
+	}
+}
+
+// 用户名不区分大小写，统一转为小写，避免只有大小写不同的两个用户在 hysteria 中冲突
+func normalizeUsername(name string) string {
+	return strings.ToLower(name)
+}
+
+// 生成随机强密码
+func GeneratePassword() (string, error) {
+	max := big.NewInt(int64(len(generatedPasswordCharset)))
+	password := make([]byte, generatedPasswordLength)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = generatedPasswordCharset[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// 用户当前是否允许连接
+func (u *HysteriaUser) Active(now time.Time) bool {
+	return u.Enabled && (u.ExpiresAt == nil || now.Before(*u.ExpiresAt))
+}
+
+// 计算用户状态
+func (u *HysteriaUser) status(now time.Time, used uint64) string {
+	switch {
+	case !u.Enabled && u.DisabledReason != "":
+		return u.DisabledReason
+	case !u.Enabled:
+		return UserStatusDisabled
+	case u.ExpiresAt != nil && !now.Before(*u.ExpiresAt):
+		return UserStatusExpired
+	case u.QuotaBytes > 0 && used >= u.QuotaBytes:
+		return UserStatusQuotaExceeded
+	}
+	return UserStatusActive
+}
+
+// 填充流量使用情况
+func (s *UserService) fillUsage(users []HysteriaUser) {
+	now := time.Now()
+	for i := range users {
+		user := &users[i]
+		traffic := s.trafficService.GetUserTraffic(user.Username)
+		usage := &UserUsage{
+			Tx:   traffic.Tx,
+			Rx:   traffic.Rx,
+			Used: traffic.Tx + traffic.Rx,
+		}
+		usage.Status = user.status(now, usage.Used)
+		if user.QuotaBytes > 0 {
+			remaining := uint64(0)
+			if usage.Used < user.QuotaBytes {
+				remaining = user.QuotaBytes - usage.Used
+			}
+			usage.Remaining = &remaining
+		}
+		if user.ResetDay > 0 {
+			next := nextResetTime(now, user.ResetDay)
+			usage.NextReset = &next
+		}
+		user.Usage = usage
+	}
+}
+
+// 某月的重置时间，重置日超过当月天数时取当月最后一天
+func resetTimeIn(year int, month time.Month, day int, loc *time.Location) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// 不晚于 now 的最近一次重置时间
+func lastResetTime(now time.Time, day int) time.Time {
+	year, month, _ := now.Date()
+	t := resetTimeIn(year, month, day, now.Location())
+	if t.After(now) {
+		t = resetTimeIn(year, month-1, day, now.Location())
+	}
+	return t
+}
+
+// 晚于 now 的下一次重置时间
+func nextResetTime(now time.Time, day int) time.Time {
+	year, month, _ := now.Date()
+	t := resetTimeIn(year, month, day, now.Location())
+	if !t.After(now) {
+		t = resetTimeIn(year, month+1, day, now.Location())
+	}
+	return t
+}
+
+// 根据当前配置判断用户保存在哪里
+func (s *UserService) authMode() (string, error) {
+	cfg, err := s.hy2Service.GetParsedConfig()
+	if err != nil {
+		return "", err
+	}
+	if cfg.Auth != nil {
+		switch {
+		case cfg.Auth.Type == "userpass":
+			return AuthModeUserpass, nil
+		case cfg.Auth.Type == "http" && cfg.Auth.HTTP != nil && cfg.Auth.HTTP.URL == s.authServer.URL():
+			return AuthModeHTTP, nil
+		}
+	}
+	return "", ErrAuthNotManaged
+}
+
+// 获取用户列表
+func (s *UserService) ListUsers() ([]HysteriaUser, error) {
+	mode, err := s.authMode()
+	if err != nil {
+		return nil, err
+	}
+	var users []HysteriaUser
+	if mode == AuthModeHTTP {
+		users = s.authServer.Store().List()
+	} else {
+		cfg, err := s.hy2Service.GetParsedConfig()
+		if err != nil {
+			return nil, err
+		}
+		users = make([]HysteriaUser, 0, len(cfg.Auth.UserPass))
+		for name, password := range cfg.Auth.UserPass {
+			users = append(users, HysteriaUser{Username: normalizeUsername(name), Password: password, Enabled: true})
+		}
+		sort.Slice(users, func(i, j int) bool {
+			return users[i].Username < users[j].Username
+		})
+	}
+
+	s.fillUsage(users)
+	return users, nil
+}
+
+// 获取单个用户
+func (s *UserService) GetUser(name string) (*HysteriaUser, error) {
+	name = normalizeUsername(name)
+	users, err := s.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Username == name {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// 批量新增用户，userpass 模式下整批只重启一次服务
+// overwrite 为 true 时已存在的用户会被覆盖，否则返回 ErrUserExists
+func (s *UserService) AddUsers(ctx context.Context, inputs []UserInput, overwrite bool) ([]HysteriaUser, *ConfigApplyResult, error) {
+	lease, ctx, err := BeginOperation(ctx, "add_users")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lease.Release()
+
+	mode, err := s.authMode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users := make([]HysteriaUser, 0, len(inputs))
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		user, err := resolveUserInput(input, mode)
+		if err != nil {
+			return nil, nil, err
+		}
+		if seen[user.Username] {
+			return nil, nil, fmt.Errorf("%w: duplicate username %s", ErrInvalidUser, user.Username)
+		}
+		seen[user.Username] = true
+		users = append(users, *user)
+	}
+	if len(users) == 0 {
+		return nil, nil, fmt.Errorf("%w: no users given", ErrInvalidUser)
+	}
+
+	if mode == AuthModeHTTP {
+		err := s.authServer.Store().Update(func(stored map[string]*HysteriaUser) error {
+			for i := range users {
+				if _, ok := stored[users[i].Username]; ok && !overwrite {
+					return fmt.Errorf("%w: %s", ErrUserExists, users[i].Username)
+				}
+				stored[users[i].Username] = &users[i]
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return users, nil, nil
+	}
+
+	result, err := s.modifyUserpass(ctx, func(userpass map[string]string) error {
+		for _, user := range users {
+			if _, ok := userpass[user.Username]; ok && !overwrite {
+				return fmt.Errorf("%w: %s", ErrUserExists, user.Username)
+			}
+			userpass[user.Username] = user.Password
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return users, result, nil
+}
+
+// 修改用户，未提供的字段保持不变
+func (s *UserService) UpdateUser(ctx context.Context, name string, input UserInput) (*HysteriaUser, *ConfigApplyResult, error) {
+	lease, ctx, err := BeginOperation(ctx, "update_user")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lease.Release()
+	name = normalizeUsername(name)
+
+	mode, err := s.authMode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if mode == AuthModeUserpass && input.hasPolicy() {
+		return nil, nil, fmt.Errorf("%w: enabled, expires_at and quota require agent http auth", ErrInvalidUser)
+	}
+	if input.ResetDay != nil && (*input.ResetDay < 0 || *input.ResetDay > 31) {
+		return nil, nil, fmt.Errorf("%w: reset_day must be between 0 and 31", ErrInvalidUser)
+	}
+
+	password := input.Password
+	if input.GeneratePassword {
+		if password, err = GeneratePassword(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if mode == AuthModeHTTP {
+		var updated HysteriaUser
+		err := s.authServer.Store().Update(func(stored map[string]*HysteriaUser) error {
+			user, ok := stored[name]
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrUserNotFound, name)
+			}
+			if password != "" {
+				user.Password = password
+			}
+			if input.Enabled != nil {
+				user.Enabled = *input.Enabled
+				user.DisabledReason = ""
+			}
+			if input.ExpiresAt != nil {
+				user.ExpiresAt = input.ExpiresAt
+			}
+			if input.NoExpiry {
+				user.ExpiresAt = nil
+			}
+			if input.QuotaBytes != nil {
+				user.QuotaBytes = *input.QuotaBytes
+			}
+			if input.ResetDay != nil {
+				user.ResetDay = *input.ResetDay
+			}
+			updated = *user
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return &updated, nil, nil
+	}
+
+	if password == "" {
+		return nil, nil, fmt.Errorf("%w: password is required", ErrInvalidUser)
+	}
+	result, err := s.modifyUserpass(ctx, func(userpass map[string]string) error {
+		if _, ok := userpass[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, name)
+		}
+		userpass[name] = password
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &HysteriaUser{Username: name, Password: password, Enabled: true}, result, nil
+}
+
+// 删除用户
+func (s *UserService) DeleteUser(ctx context.Context, name string) (*ConfigApplyResult, error) {
+	lease, ctx, err := BeginOperation(ctx, "delete_user")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+	name = normalizeUsername(name)
+
+	mode, err := s.authMode()
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == AuthModeHTTP {
+		return nil, s.authServer.Store().Update(func(stored map[string]*HysteriaUser) error {
+			if _, ok := stored[name]; !ok {
+				return fmt.Errorf("%w: %s", ErrUserNotFound, name)
+			}
+			delete(stored, name)
+			return nil
+		})
+	}
+
+	return s.modifyUserpass(ctx, func(userpass map[string]string) error {
+		if _, ok := userpass[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUserNotFound, name)
+		}
+		if len(userpass) == 1 {
+			return fmt.Errorf("%w: cannot delete the last user", ErrInvalidUser)
+		}
+		delete(userpass, name)
+		return nil
+	})
+}
+
+// 断开用户的现有连接，内置 HTTP 认证下删除或禁用用户不会重启 hysteria，已建立的连接需要主动踢出
+// 不是内置 HTTP 认证或未启用 trafficStats 时不做任何事，返回 false
+func (s *UserService) KickUser(ctx context.Context, name string) (bool, error) {
+	if mode, err := s.authMode(); err != nil || mode != AuthModeHTTP {
+		return false, nil
+	}
+	if err := s.trafficService.Kick(ctx, []string{normalizeUsername(name)}); err != nil {
+		if errors.Is(err, ErrTrafficStatsDisabled) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// 获取认证方式状态
+func (s *UserService) GetAuthBackend() (*AuthBackendStatus, error) {
+	status := &AuthBackendStatus{
+		URL:   s.authServer.URL(),
+		Users: len(s.authServer.Store().List()),
+	}
+
+	cfg, err := s.hy2Service.GetParsedConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Auth != nil {
+		status.AuthType = cfg.Auth.Type
+	}
+	mode, _ := s.authMode()
+	status.AgentManaged = mode == AuthModeHTTP
+	return status, nil
+}
+
+// 切换内置 HTTP 认证
+// 启用时将 userpass 中的用户导入用户存储，并把 hysteria 指向 agent；
+// 停用时把用户存储中可用的用户写回 auth.userpass
+func (s *UserService) SetHTTPAuth(ctx context.Context, enabled bool) (*ConfigApplyResult, error) {
+	lease, ctx, err := BeginOperation(ctx, "update_auth_backend")
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	doc, err := s.hy2Service.GetConfigDocument()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := doc.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	mode, _ := s.authMode()
+	if enabled {
+		if mode == AuthModeHTTP {
+			return &ConfigApplyResult{}, nil
+		}
+
+		// 导入已有 userpass 用户，不覆盖用户存储中的同名用户
+		err := s.authServer.Store().Update(func(stored map[string]*HysteriaUser) error {
+			if mode != AuthModeUserpass {
+				return nil
+			}
+			for name, password := range cfg.Auth.UserPass {
+				name = normalizeUsername(name)
+				if _, ok := stored[name]; !ok {
+					stored[name] = &HysteriaUser{Username: name, Password: password, Enabled: true}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = doc.Set(&AuthConfig{
+			Type: "http",
+			HTTP: &AuthHTTPConfig{URL: s.authServer.URL()},
+		}, "auth")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if mode != AuthModeHTTP {
+			return &ConfigApplyResult{}, nil
+		}
+
+		userpass := make(map[string]string)
+		now := time.Now()
+		for _, user := range s.authServer.Store().List() {
+			if user.Active(now) {
+				userpass[user.Username] = user.Password
+			}
+		}
+		if len(userpass) == 0 {
+			return nil, fmt.Errorf("%w: no active users to write back to auth.userpass", ErrInvalidUser)
+		}
+
+		err := doc.Set(&AuthConfig{
+			Type:     "userpass",
+			UserPass: userpass,
+		}, "auth")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := doc.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return s.hy2Service.applyConfig(ctx, data)
+}
+
+// 修改 auth.userpass 并通过事务方式应用配置，调用时需持有操作锁
+// 只改写有变化的用户，其余用户的顺序和注释保持不变
+// 传给 modify 的用户名已转为小写，配置中手动写入的大写用户名在写回时改为小写
+func (s *UserService) modifyUserpass(ctx context.Context, modify func(userpass map[string]string) error) (*ConfigApplyResult, error) {
+	doc, err := s.hy2Service.GetConfigDocument()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := doc.Config()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Auth == nil || cfg.Auth.Type != "userpass" {
+		return nil, ErrAuthNotManaged
+	}
+
+	userpass := make(map[string]string, len(cfg.Auth.UserPass))
+	for name, password := range cfg.Auth.UserPass {
+		lower := normalizeUsername(name)
+		if _, ok := userpass[lower]; ok {
+			return nil, fmt.Errorf("%w: auth.userpass contains usernames that differ only by case: %s", ErrInvalidUser, lower)
+		}
+		userpass[lower] = password
+	}
+	if err := modify(userpass); err != nil {
+		return nil, err
+	}
+
+	for name := range cfg.Auth.UserPass {
+		if _, ok := userpass[name]; !ok {
+			doc.Delete("auth", "userpass", name)
+		}
+	}
+	names := make([]string, 0, len(userpass))
+	for name := range userpass {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if old, ok := cfg.Auth.UserPass[name]; ok && old == userpass[name] {
+			continue
+		}
+		if err := doc.Set(userpass[name], "auth", "userpass", name); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := doc.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return s.hy2Service.applyConfig(ctx, data)
+}
+
+// 校验用户名，按需生成密码，用户名转为小写
+func resolveUserInput(input UserInput, mode string) (*HysteriaUser, error) {
+	input.Username = normalizeUsername(input.Username)
+	if !usernamePattern.MatchString(input.Username) {
+		return nil, fmt.Errorf("%w: invalid username %q", ErrInvalidUser, input.Username)
+	}
+	if mode == AuthModeUserpass && input.hasPolicy() {
+		return nil, fmt.Errorf("%w: enabled, expires_at and quota require agent http auth", ErrInvalidUser)
+	}
+	if input.ResetDay != nil && (*input.ResetDay < 0 || *input.ResetDay > 31) {
+		return nil, fmt.Errorf("%w: reset_day must be between 0 and 31", ErrInvalidUser)
+	}
+
+	password := input.Password
+	if input.GeneratePassword {
+		generated, err := GeneratePassword()
+		if err != nil {
+			return nil, err
+		}
+		password = generated
+	}
+	if password == "" {
+		return nil, fmt.Errorf("%w: password of %s is empty", ErrInvalidUser, input.Username)
+	}
+
+	user := &HysteriaUser{
+		Username:  input.Username,
+		Password:  password,
+		Enabled:   true,
+		ExpiresAt: input.ExpiresAt,
+	}
+	if input.Enabled != nil {
+		user.Enabled = *input.Enabled
+	}
+	if input.QuotaBytes != nil {
+		user.QuotaBytes = *input.QuotaBytes
+	}
+	if input.ResetDay != nil && *input.ResetDay > 0 {
+		now := time.Now()
+		user.ResetDay = *input.ResetDay
+		user.LastReset = &now
+	}
+	return user, nil
+}
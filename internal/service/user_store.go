@@ -0,0 +1,138 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const userStorePath = "/etc/hy2agent/users.json"
+
+// 持久化的用户存储，供内置 HTTP 认证使用
+type UserStore struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]*HysteriaUser
+}
+
+// 加载用户存储，文件不存在时返回空存储
+func LoadUserStore() (*UserStore, error) {
+	store := &UserStore{
+		path:  userStorePath,
+		users: make(map[string]*HysteriaUser),
+	}
+
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*HysteriaUser
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, err
+	}
+	// 旧版本允许大写用户名，加载时统一转为小写，只差大小写的用户只保留第一个
+	for _, user := range users {
+		user.Username = normalizeUsername(user.Username)
+		if _, ok := store.users[user.Username]; ok {
+			log.Printf("用户存储中存在只差大小写的重复用户 %s，已忽略", user.Username)
+			continue
+		}
+		store.users[user.Username] = user
+	}
+	return store, nil
+}
+
+// 获取所有用户，按用户名排序
+func (s *UserStore) List() []HysteriaUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]HysteriaUser, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users
+}
+
+// 获取单个用户
+func (s *UserStore) Get(name string) (HysteriaUser, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[name]
+	if !ok {
+		return HysteriaUser{}, false
+	}
+	return *user, true
+}
+
+// 在锁内修改用户并持久化，modify 返回错误时不做任何修改
+func (s *UserStore) Update(modify func(users map[string]*HysteriaUser) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 在副本上修改，保证失败时内存状态不变
+	users := make(map[string]*HysteriaUser, len(s.users))
+	for name, user := range s.users {
+		copied := *user
+		users[name] = &copied
+	}
+	if err := modify(users); err != nil {
+		return err
+	}
+	if err := s.save(users); err != nil {
+		return err
+	}
+	s.users = users
+	return nil
+}
+
+// 校验认证信息，返回是否允许连接
+func (s *UserStore) Authenticate(name, password string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[name]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1 &&
+		user.Active(time.Now())
+}
+
+// 写入文件，先写临时文件再重命名
+func (s *UserStore) save(users map[string]*HysteriaUser) error {
+	list := make([]*HysteriaUser, 0, len(users))
+	for _, user := range users {
+		list = append(list, user)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Username < list[j].Username
+	})
+
+	data, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResetTime(t *testing.T) {
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		day      int
+		wantLast time.Time
+		wantNext time.Time
+	}{
+		{
+			name:     "before reset day",
+			now:      date(2026, 5, 10, 12),
+			day:      15,
+			wantLast: date(2026, 4, 15, 0),
+			wantNext: date(2026, 5, 15, 0),
+		},
+		{
+			name:     "after reset day",
+			now:      date(2026, 5, 20, 12),
+			day:      15,
+			wantLast: date(2026, 5, 15, 0),
+			wantNext: date(2026, 6, 15, 0),
+		},
+		{
+			name:     "exactly at reset",
+			now:      date(2026, 5, 15, 0),
+			day:      15,
+			wantLast: date(2026, 5, 15, 0),
+			wantNext: date(2026, 6, 15, 0),
+		},
+		{
+			name:     "day clamped to end of february",
+			now:      date(2026, 2, 10, 0),
+			day:      31,
+			wantLast: date(2026, 1, 31, 0),
+			wantNext: date(2026, 2, 28, 0),
+		},
+		{
+			name:     "leap year february",
+			now:      date(2028, 3, 1, 0),
+			day:      30,
+			wantLast: date(2028, 2, 29, 0),
+			wantNext: date(2028, 3, 30, 0),
+		},
+		{
+			name:     "clamped day then full day next month",
+			now:      date(2026, 4, 30, 12),
+			day:      31,
+			wantLast: date(2026, 4, 30, 0),
+			wantNext: date(2026, 5, 31, 0),
+		},
+		{
+			name:     "across new year",
+			now:      date(2026, 12, 31, 12),
+			day:      1,
+			wantLast: date(2026, 12, 1, 0),
+			wantNext: date(2027, 1, 1, 0),
+		},
+		{
+			name:     "back into previous year",
+			now:      date(2027, 1, 5, 12),
+			day:      10,
+			wantLast: date(2026, 12, 10, 0),
+			wantNext: date(2027, 1, 10, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lastResetTime(tt.now, tt.day); !got.Equal(tt.wantLast) {
+				t.Errorf("lastResetTime() = %v, want %v", got, tt.wantLast)
+			}
+			if got := nextResetTime(tt.now, tt.day); !got.Equal(tt.wantNext) {
+				t.Errorf("nextResetTime() = %v, want %v", got, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestResetTimeKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	// UTC 时间还在上个月，本地时间已经到了重置日
+	now := time.Date(2026, 6, 1, 1, 0, 0, 0, loc)
+
+	want := time.Date(2026, 6, 1, 0, 0, 0, 0, loc)
+	if got := lastResetTime(now, 1); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("lastResetTime() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveUserInputUsername(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "alice", want: "alice"},
+		{input: "Alice", want: "alice"},
+		{input: "BOB.smith@example.com", want: "bob.smith@example.com"},
+		{input: "", wantErr: true},
+		{input: "alice:admin", wantErr: true},
+		{input: "ålice", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		user, err := resolveUserInput(UserInput{Username: tt.input, Password: "secret"}, AuthModeUserpass)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidUser) {
+				t.Errorf("resolveUserInput(%q) error = %v, want ErrInvalidUser", tt.input, err)
+			}
+			continue
+		}
+		if err != nil || user.Username != tt.want {
+			t.Errorf("resolveUserInput(%q) = %v, %v; want username %q", tt.input, user, err, tt.want)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	v1 "hy2agent/api/v1"
 	"hy2agent/internal/config"
+	"hy2agent/internal/service"
 	"log"
 	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,15 +38,61 @@ func main() {
 	// 打印API Key，仅在首次安装时显示
 	log.Printf("Agent API Key: %s", cfg.APIKey)
 
+	// 内置HTTP认证服务
+	userStore, err := service.LoadUserStore()
+	if err != nil {
+		log.Fatalf("Failed to load user store: %v", err)
+	}
+	authServer := service.NewAuthServer(userStore, cfg.HTTPAuthListen)
+	go func() {
+		if err := authServer.Run(); err != nil {
+			log.Printf("HTTP 认证服务启动失败: %v", err)
+		}
+	}()
+
+	// 流量统计
+	trafficService, err := service.NewTrafficService()
+	if err != nil {
+		log.Fatalf("Failed to load traffic data: %v", err)
+	}
+	go trafficService.Run(time.Duration(cfg.TrafficPoll) * time.Second)
+
+	// 恢复端口跳跃规则，系统重启后规则需要重新下发
+	if err := service.NewPortHoppingService().Restore(service.WithOperationWait(context.Background(), service.MaxOperationWait)); err != nil {
+		log.Printf("恢复端口跳跃规则失败: %v", err)
+	}
+
+	// 配额和过期检查
+	enforcer := service.NewQuotaEnforcer(service.NewUserService(authServer, trafficService), trafficService)
+	go enforcer.Run(service.DefaultEnforceInterval)
+
+	// 计划变更，到期后自动应用
+	stagedService, err := service.NewStagedConfigService()
+	if err != nil {
+		log.Fatalf("Failed to load staged configs: %v", err)
+	}
+	go stagedService.Run(service.DefaultStageCheckInterval)
+
 	r := gin.Default()
 
+	// 订阅API，使用独立的订阅令牌认证，需在认证中间件之前注册
+	subscriptionHandler := v1.NewSubscriptionHandler(cfg.APIKey, authServer, trafficService)
+	r.GET("/sub/:token", subscriptionHandler.GetSubscription)
+
 	// API认证中间件
 	r.Use(authMiddleware(cfg))
 
+	// 后台任务
+	jobManager, err := service.NewJobManager()
+	if err != nil {
+		log.Fatalf("Failed to load job history: %v", err)
+	}
+
 	// API路由
 	statusHandler := v1.NewStatusHandler()
 	systemHandler := v1.NewSystemHandler()
-	hysteria2Handler := v1.NewHysteria2Handler()
+	certService := service.NewCertificateService(*certFile, *keyFile, cfg.CertWarnDays)
+	hysteria2Handler := v1.NewHysteria2Handler(cfg, jobManager, certService)
 
 	// 状态API
 	r.GET("/api/v1/status", statusHandler.GetStatus)
@@ -61,20 +110,94 @@ func main() {
 	hysteria2Group := r.Group("/api/v1/hysteria")
 	{
 		hysteria2Group.GET("/status", hysteria2Handler.GetStatus)
+		hysteria2Group.GET("/process", hysteria2Handler.GetProcess)
 		hysteria2Group.GET("/config", hysteria2Handler.GetConfig)
 		hysteria2Group.PUT("/config", hysteria2Handler.UpdateConfig)
+		hysteria2Group.PATCH("/config", hysteria2Handler.PatchConfig)
 		hysteria2Group.GET("/logs", hysteria2Handler.GetLogs)
 		hysteria2Group.POST("/install", hysteria2Handler.Install)
+		hysteria2Group.POST("/install/upload", hysteria2Handler.InstallUpload)
 		hysteria2Group.POST("/uninstall", hysteria2Handler.Uninstall)
 		hysteria2Group.POST("/update", hysteria2Handler.Update)
 		hysteria2Group.POST("/restart", hysteria2Handler.Restart)
 		hysteria2Group.POST("/stop", hysteria2Handler.Stop)
 		hysteria2Group.POST("/start", hysteria2Handler.Start)
 		hysteria2Group.GET("/health", hysteria2Handler.CheckHealth)
+		hysteria2Group.GET("/certificates", hysteria2Handler.GetCertificates)
 		hysteria2Group.GET("/versions", hysteria2Handler.GetVersions)
 		hysteria2Group.POST("/versions/install", hysteria2Handler.InstallVersion)
+		hysteria2Group.GET("/binaries", hysteria2Handler.GetBinaries)
+		hysteria2Group.POST("/rollback", hysteria2Handler.Rollback)
 		hysteria2Group.GET("/config/backups", hysteria2Handler.GetConfigBackups)
+		hysteria2Group.GET("/config/backups/diff", hysteria2Handler.DiffConfigBackups)
+		hysteria2Group.GET("/config/backups/retention", hysteria2Handler.GetConfigBackupRetention)
+		hysteria2Group.PUT("/config/backups/retention", hysteria2Handler.UpdateConfigBackupRetention)
+		hysteria2Group.GET("/config/backups/:name", hysteria2Handler.GetConfigBackup)
+		hysteria2Group.PATCH("/config/backups/:name", hysteria2Handler.UpdateConfigBackup)
+		hysteria2Group.DELETE("/config/backups/:name", hysteria2Handler.DeleteConfigBackup)
 		hysteria2Group.POST("/config/restore", hysteria2Handler.RestoreConfig)
+		hysteria2Group.POST("/config/validate", hysteria2Handler.ValidateConfig)
+		hysteria2Group.POST("/config/preview", hysteria2Handler.PreviewConfig)
+		hysteria2Group.GET("/config/:section", hysteria2Handler.GetConfigSection)
+		hysteria2Group.PATCH("/config/:section", hysteria2Handler.PatchConfigSection)
+		hysteria2Group.GET("/operations/current", hysteria2Handler.GetCurrentOperation)
+	}
+
+	// 后台任务API
+	jobHandler := v1.NewJobHandler(jobManager)
+	jobGroup := r.Group("/api/v1/jobs")
+	{
+		jobGroup.GET("", jobHandler.ListJobs)
+		jobGroup.GET("/:id", jobHandler.GetJob)
+		jobGroup.GET("/:id/stream", jobHandler.StreamJob)
+		jobGroup.POST("/:id/cancel", jobHandler.CancelJob)
+	}
+
+	// 计划变更API
+	stagedHandler := v1.NewStagedConfigHandler(stagedService)
+	stagedGroup := r.Group("/api/v1/hysteria/config/staged")
+	{
+		stagedGroup.GET("", stagedHandler.ListStagedConfigs)
+		stagedGroup.POST("", stagedHandler.CreateStagedConfig)
+		stagedGroup.GET("/:id", stagedHandler.GetStagedConfig)
+		stagedGroup.DELETE("/:id", stagedHandler.CancelStagedConfig)
+	}
+
+	// 端口跳跃API
+	portHoppingHandler := v1.NewPortHoppingHandler()
+	r.GET("/api/v1/hysteria/port-hopping", portHoppingHandler.GetPortHopping)
+	r.PUT("/api/v1/hysteria/port-hopping", portHoppingHandler.UpdatePortHopping)
+
+	// Hysteria2用户管理API
+	userHandler := v1.NewUserHandler(authServer, trafficService)
+	userGroup := r.Group("/api/v1/hysteria/users")
+	{
+		userGroup.GET("", userHandler.ListUsers)
+		userGroup.POST("", userHandler.AddUser)
+		userGroup.POST("/import", userHandler.ImportUsers)
+		userGroup.GET("/:name", userHandler.GetUser)
+		userGroup.PUT("/:name", userHandler.UpdateUser)
+		userGroup.DELETE("/:name", userHandler.DeleteUser)
+		userGroup.GET("/:name/share", userHandler.GetShareLink)
+		userGroup.GET("/:name/subscription", subscriptionHandler.GetToken)
+	}
+	r.POST("/api/v1/hysteria/share/parse", userHandler.ParseShareLink)
+	r.GET("/api/v1/hysteria/auth-backend", userHandler.GetAuthBackend)
+	r.PUT("/api/v1/hysteria/auth-backend", userHandler.UpdateAuthBackend)
+
+	// 端到端探测API
+	probeHandler := v1.NewProbeHandler(cfg, authServer, trafficService)
+	r.POST("/api/v1/hysteria/probe", probeHandler.Probe)
+
+	// 流量统计API
+	trafficHandler := v1.NewTrafficHandler(trafficService)
+	trafficGroup := r.Group("/api/v1/hysteria")
+	{
+		trafficGroup.GET("/traffic", trafficHandler.GetTraffic)
+		trafficGroup.GET("/online", trafficHandler.GetOnline)
+		trafficGroup.POST("/kick", trafficHandler.Kick)
+		trafficGroup.GET("/traffic-stats", trafficHandler.GetTrafficStats)
+		trafficGroup.PUT("/traffic-stats", trafficHandler.UpdateTrafficStats)
 	}
 
 	// 配置管理API